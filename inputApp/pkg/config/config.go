@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/configload"
+)
+
+// Duration is a time.Duration read as "10s", "1m30s"... from YAML and env.
+type Duration = configload.Duration
+
+// Config is everything inputApp reads at startup.
+// Values come from the defaults below, then CONFIG_FILE (YAML) and then env vars.
+type Config struct {
+	Port          int    `yaml:"port" env:"PORT"`
+	CollectorAddr string `yaml:"collector_addr" env:"OTEL_COLLECTOR_ADDR"`
+	// WriteTimeout é o prazo para responder, a request ao tempByCep tem que caber nele
+	WriteTimeout Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+
+	TempByCep TempByCepConfig `yaml:"tempbycep"`
+}
+
+type TempByCepConfig struct {
+	// BaseURL é onde o tempByCep responde, as rotas (/temp/...) são adicionadas pelo client
+	BaseURL        string   `yaml:"base_url" env:"TEMPBYCEP_URL"`
+	RequestTimeout Duration `yaml:"request_timeout" env:"TEMPBYCEP_REQUEST_TIMEOUT"`
+	// BatchTimeout é o prazo de um POST /temp/batch, que resolve vários CEPs
+	BatchTimeout Duration `yaml:"batch_timeout" env:"TEMPBYCEP_BATCH_TIMEOUT"`
+}
+
+func Default() Config {
+	return Config{
+		Port:          8091,
+		CollectorAddr: "otel-collector:4317",
+		// maior que o WriteTimeout do tempByCep (10s), assim o 504 dele chega até o cliente
+		WriteTimeout: Duration(15 * time.Second),
+		TempByCep: TempByCepConfig{
+			BaseURL:        "http://tempbycep:8090",
+			RequestTimeout: Duration(10 * time.Second),
+			BatchTimeout:   Duration(60 * time.Second),
+		},
+	}
+}
+
+// Load reads the config from CONFIG_FILE and the env vars and validates it.
+func Load() (Config, error) {
+	cfg := Default()
+	err := configload.Load(&cfg, os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return Config{}, err
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid value at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	if _, _, err := net.SplitHostPort(c.CollectorAddr); err != nil {
+		errs = append(errs, fmt.Errorf("OTEL_COLLECTOR_ADDR must be host:port, got %q", c.CollectorAddr))
+	}
+	if u, err := url.Parse(c.TempByCep.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("TEMPBYCEP_URL must be an absolute url, got %q", c.TempByCep.BaseURL))
+	}
+	if c.TempByCep.RequestTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("TEMPBYCEP_REQUEST_TIMEOUT must be greater than zero, got %s", c.TempByCep.RequestTimeout))
+	}
+	if c.TempByCep.RequestTimeout >= c.WriteTimeout {
+		errs = append(errs, fmt.Errorf("HTTP_WRITE_TIMEOUT must be longer than TEMPBYCEP_REQUEST_TIMEOUT (%s), got %s", c.TempByCep.RequestTimeout, c.WriteTimeout))
+	}
+	if c.TempByCep.BatchTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("TEMPBYCEP_BATCH_TIMEOUT must be greater than zero, got %s", c.TempByCep.BatchTimeout))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// String prints the config with the secrets redacted, one env var per line.
+func (c Config) String() string {
+	return configload.Format(c)
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if cfg != Default() {
+		t.Errorf("Load() without file and env did not return the defaults: %+v", cfg)
+	}
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte(`
+port: 9001
+tempbycep:
+  base_url: http://localhost:8090
+  request_timeout: 5s
+`), 0o644)
+	t.Setenv("CONFIG_FILE", file)
+	// env vence o arquivo
+	t.Setenv("TEMPBYCEP_REQUEST_TIMEOUT", "2s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if cfg.Port != 9001 || cfg.TempByCep.BaseURL != "http://localhost:8090" {
+		t.Errorf("Load() did not read the file: %+v", cfg)
+	}
+	if time.Duration(cfg.TempByCep.RequestTimeout) != 2*time.Second {
+		t.Errorf("Load() did not let env override the file: %s", cfg.TempByCep.RequestTimeout)
+	}
+}
+
+func TestLoadReportsEveryInvalidValue(t *testing.T) {
+	t.Setenv("PORT", "70000")
+	t.Setenv("OTEL_COLLECTOR_ADDR", "otel-collector")
+	t.Setenv("TEMPBYCEP_URL", "tempbycep")
+	// a request ao tempByCep não cabe no prazo de resposta
+	t.Setenv("TEMPBYCEP_REQUEST_TIMEOUT", "20s")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatalf("Load() accepted an invalid config")
+	}
+	for _, name := range []string{"PORT", "OTEL_COLLECTOR_ADDR", "TEMPBYCEP_URL", "HTTP_WRITE_TIMEOUT"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Load() error does not mention %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/JonecoBoy/otel-cep/inputApp/pkg/utils"
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Temperature struct {
+	C float32 `json:"c"`
+	F float32 `json:"f"`
+	K float32 `json:"k"`
+}
+
+type ForecastByCepResponse struct {
+	City string               `json:"city"`
+	Days []ForecastDaySummary `json:"days"`
+}
+
+type ForecastDaySummary struct {
+	Date         string                `json:"date"`
+	Min          Temperature           `json:"min"`
+	Max          Temperature           `json:"max"`
+	Avg          Temperature           `json:"avg"`
+	ChanceOfRain float32               `json:"chance_of_rain"`
+	Condition    string                `json:"condition"`
+	Hours        []ForecastHourSummary `json:"hours,omitempty"`
+}
+
+type ForecastHourSummary struct {
+	Time         string      `json:"time"`
+	Temp         Temperature `json:"temp"`
+	ChanceOfRain float32     `json:"chance_of_rain"`
+	Condition    string      `json:"condition"`
+}
+
+// GetForecastByCep asks tempByCep for the forecast of the city of cep. The query (days, hourly)
+// is forwarded as is, tempByCep is the one that validates it.
+func GetForecastByCep(ctx context.Context, cep string, query url.Values) (ForecastByCepResponse, error) {
+	ctx, externalSpan := otel.GetTracerProvider().Tracer("weather").Start(ctx, "GetForecastByCep-external")
+	defer externalSpan.End()
+	err := utils.ValidateCep(cep)
+	if err != nil {
+		return ForecastByCepResponse{}, utils.InvalidZipError
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestExpirationTime)
+	defer cancel()
+
+	var forecast ForecastByCepResponse
+	err = getJSON(ctx, "/forecast/"+cep, query, &forecast)
+	if err != nil {
+		return ForecastByCepResponse{}, err
+	}
+	return forecast, nil
+}
+
+// getJSON makes a GET to tempByCep and decodes a 200 answer into out, any other answer
+// becomes the error of statusError. The status is recorded on the span of ctx.
+func getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	externalSpan := trace.SpanFromContext(ctx)
+
+	target := tempByCepUrl + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	// propagar otel!  na request
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	externalSpan.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		err = statusError(resp)
+		var problem *apperr.Problem
+		if errors.As(err, &problem) {
+			externalSpan.SetAttributes(attribute.String("tempbycep.problem.type", problem.Type))
+		}
+		externalSpan.RecordError(err)
+		externalSpan.SetStatus(codes.Error, resp.Status)
+		return err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	return nil
+}
@@ -1,18 +1,41 @@
 package external
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/JonecoBoy/otel-cep/inputApp/pkg/utils"
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
-//const requestExpirationTime = 10 * time.Second
+var requestExpirationTime = 10 * time.Second
+var batchExpirationTime = 60 * time.Second
+var tempByCepUrl = "http://tempbycep:8090"
+
+// Settings are the values of this package that come from the service config.
+type Settings struct {
+	TempByCepURL   string
+	RequestTimeout time.Duration
+	BatchTimeout   time.Duration
+}
+
+// Configure replaces the package defaults, it must be called before any request is made.
+func Configure(s Settings) {
+	tempByCepUrl = strings.TrimSuffix(s.TempByCepURL, "/")
+	requestExpirationTime = s.RequestTimeout
+	batchExpirationTime = s.BatchTimeout
+}
 
 type TempByCepResponse struct {
 	City   string  `json:"city"`
@@ -30,6 +53,54 @@ type Address struct {
 	Source       string `json:"source"`
 }
 
+// requestError classifies a failed call to tempByCep, ctx is the context of that call.
+func requestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return apperr.Wrap(apperr.UpstreamTimeout, err, "tempByCep did not answer in time")
+	}
+	return apperr.Wrap(apperr.UpstreamUnavailable, err, "tempByCep request failed")
+}
+
+// maxErrorDetail limita quanto de um body de erro que não é problem+json vai para o detalhe
+const maxErrorDetail = 512
+
+// statusError classifies a failed answer of tempByCep. A problem document is returned
+// as is, any other body becomes the detail of an error classified by the status.
+func statusError(resp *http.Response) error {
+	if problem := apperr.ReadProblem(resp); problem != nil {
+		return problem
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorDetail))
+	detail := strings.TrimSpace(string(body))
+	cause := fmt.Errorf("tempByCep answered %s", resp.Status)
+
+	var kind *apperr.Kind
+	switch {
+	case resp.StatusCode == http.StatusUnprocessableEntity:
+		kind = apperr.InvalidInput
+		if detail == "" {
+			detail = utils.InvalidZipError.Message
+		}
+	case resp.StatusCode == http.StatusNotFound:
+		kind = apperr.NotFound
+		if detail == "" {
+			detail = utils.ZipNotFoundError.Message
+		}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		kind = apperr.RateLimited
+	case resp.StatusCode == http.StatusGatewayTimeout:
+		kind = apperr.UpstreamTimeout
+	default:
+		// qualquer outra resposta é uma falha do tempByCep, não de quem chamou
+		kind = apperr.UpstreamUnavailable
+	}
+	if detail == "" {
+		detail = cause.Error()
+	}
+	return apperr.Wrap(kind, cause, detail)
+}
+
 func GetTempByCep(ctx context.Context, cep string) (TempByCepResponse, error) {
 	ctx, externalSpan := otel.GetTracerProvider().Tracer("weather").Start(ctx, "GetTempByCep-external")
 	defer externalSpan.End()
@@ -38,55 +109,133 @@ func GetTempByCep(ctx context.Context, cep string) (TempByCepResponse, error) {
 		return TempByCepResponse{}, utils.InvalidZipError
 	}
 
-	//// o contexto expira em 1 segundo!
-	//ctx, cancel := context.WithTimeout(ctx, requestExpirationTime)
-	//defer cancel() // de alguma forma nosso contexto será cancelado
-
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://tempbycep:8090/temp/"+cep, nil)
+	ctx, cancel := context.WithTimeout(ctx, requestExpirationTime)
+	defer cancel() // de alguma forma nosso contexto será cancelado
 
+	var tempCepData TempByCepResponse
+	err = getJSON(ctx, "/temp/"+cep, nil, &tempCepData)
 	if err != nil {
 		return TempByCepResponse{}, err
 	}
-	// propagar otel!  na request
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	resp, err := http.DefaultClient.Do(req)
+	//empty struct = valid format but no data
+	if (tempCepData == TempByCepResponse{}) {
+		return TempByCepResponse{}, utils.ZipNotFoundError
+	}
+
+	return tempCepData, nil
+}
+
+// TempByCepBatchItem is the answer of tempByCep for the CEP at Index of a batch.
+type TempByCepBatchItem struct {
+	Index int                `json:"index"`
+	Cep   string             `json:"cep"`
+	Temp  *TempByCepResponse `json:"temp,omitempty"`
+	Error *apperr.Problem    `json:"error,omitempty"`
+}
+
+type tempByCepBatchRequest struct {
+	Ceps []string `json:"ceps"`
+}
+
+type tempByCepBatchResponse struct {
+	Results []TempByCepBatchItem `json:"results"`
+}
 
+// GetTempByCepBatch resolves every CEP in a single POST /temp/batch, the items keep the order of ceps.
+func GetTempByCepBatch(ctx context.Context, ceps []string) ([]TempByCepBatchItem, error) {
+	ctx, externalSpan := otel.GetTracerProvider().Tracer("weather").Start(ctx, "GetTempByCepBatch-external")
+	defer externalSpan.End()
+
+	ctx, cancel := context.WithTimeout(ctx, batchExpirationTime)
+	defer cancel()
+
+	resp, err := postBatch(ctx, ceps, "application/json")
 	if err != nil {
-		return TempByCepResponse{}, err
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	var batch tempByCepBatchResponse
+	err = json.NewDecoder(resp.Body).Decode(&batch)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+	if len(batch.Results) != len(ceps) {
+		return nil, apperr.New(apperr.UpstreamUnavailable, fmt.Sprintf("tempByCep answered %d items for %d ceps", len(batch.Results), len(ceps)))
+	}
+	return batch.Results, nil
+}
 
-		if resp.StatusCode == http.StatusNotFound {
-			return TempByCepResponse{}, utils.ZipNotFoundError
-		}
+// StreamTempByCepBatch asks tempByCep to stream the batch as NDJSON and calls onItem for each
+// CEP as soon as it is resolved, in completion order. An error from onItem stops the stream.
+func StreamTempByCepBatch(ctx context.Context, ceps []string, onItem func(TempByCepBatchItem) error) error {
+	ctx, externalSpan := otel.GetTracerProvider().Tracer("weather").Start(ctx, "StreamTempByCepBatch-external")
+	defer externalSpan.End()
 
-		return TempByCepResponse{}, errors.New("unkown error")
+	ctx, cancel := context.WithTimeout(ctx, batchExpirationTime)
+	defer cancel()
 
+	resp, err := postBatch(ctx, ceps, "application/x-ndjson")
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
-	if ctx.Err() == context.DeadlineExceeded {
-		fmt.Println("Api fetch timeout exceeed.")
-		return TempByCepResponse{}, errors.New("api fetch timeout exceeed")
+	received := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var item TempByCepBatchItem
+		err = json.Unmarshal(scanner.Bytes(), &item)
+		if err != nil {
+			return apperr.Wrap(apperr.UpstreamUnavailable, err, "tempByCep streamed an invalid item")
+		}
+		received++
+		err = onItem(item)
+		if err != nil {
+			return err
+		}
+	}
+	externalSpan.SetAttributes(attribute.Int("batch.received", received))
+	if scanner.Err() != nil {
+		return requestError(ctx, scanner.Err())
 	}
+	if received != len(ceps) {
+		return apperr.New(apperr.UpstreamUnavailable, fmt.Sprintf("tempByCep streamed %d items for %d ceps", received, len(ceps)))
+	}
+	return nil
+}
 
-	// depois de tudo termina e faz o body
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+// postBatch sends the batch to tempByCep and returns the answer when it is a 200, the caller must close the body.
+func postBatch(ctx context.Context, ceps []string, accept string) (*http.Response, error) {
+	externalSpan := trace.SpanFromContext(ctx)
+	externalSpan.SetAttributes(attribute.Int("batch.size", len(ceps)))
+
+	body, err := json.Marshal(tempByCepBatchRequest{Ceps: ceps})
 	if err != nil {
-		return TempByCepResponse{}, err
+		return nil, err
 	}
-	var tempCepData TempByCepResponse
-	err = json.Unmarshal(body, &tempCepData)
+	req, err := http.NewRequestWithContext(ctx, "POST", tempByCepUrl+"/temp/batch", bytes.NewReader(body))
 	if err != nil {
-		return TempByCepResponse{}, err
+		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	// propagar otel!  na request
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	//empty struct = valid format but no data
-	if (tempCepData == TempByCepResponse{}) {
-		return TempByCepResponse{}, utils.ZipNotFoundError
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, requestError(ctx, err)
 	}
 
-	return tempCepData, nil
+	externalSpan.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		err = statusError(resp)
+		externalSpan.RecordError(err)
+		externalSpan.SetStatus(codes.Error, resp.Status)
+		return nil, err
+	}
+	return resp, nil
 }
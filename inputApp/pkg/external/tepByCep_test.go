@@ -2,11 +2,38 @@ package external
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
+// requireLiveTempByCep pula os testes que precisam de um tempByCep de verdade rodando em TEMPBYCEP_URL,
+// que só rodam com LIVE_TESTS definido. O client é coberto offline pelos servidores de teste abaixo.
+func requireLiveTempByCep(t *testing.T) {
+	t.Helper()
+	if os.Getenv("LIVE_TESTS") == "" {
+		t.Skip("LIVE_TESTS is not set, skipping the test against a running tempByCep")
+	}
+	if url := os.Getenv("TEMPBYCEP_URL"); url != "" {
+		previous := tempByCepUrl
+		tempByCepUrl = url
+		t.Cleanup(func() { tempByCepUrl = previous })
+	}
+}
+
 func TestShouldReturnCepWithCityAndTemperature(t *testing.T) {
+	requireLiveTempByCep(t)
+
 	cep := "20541155"
 	result, err := GetTempByCep(context.Background(), cep)
 	if err != nil {
@@ -63,6 +90,8 @@ func TestShouldReturnInvalidZipCodeError(t *testing.T) {
 }
 
 func TestShouldReturnCanNotFindZipCode(t *testing.T) {
+	requireLiveTempByCep(t)
+
 	//404
 	cep := "99900028"
 	result, err := GetTempByCep(context.Background(), cep)
@@ -96,3 +125,65 @@ func TestShouldReturnCanNotFindZipCode(t *testing.T) {
 		t.Errorf("getTempByCep() did not return the correct error message")
 	}
 }
+
+func TestGetTempByCepClassifiesUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		status      int
+		contentType string
+		body        string
+		kind        *apperr.Kind
+		detail      string
+	}{
+		{http.StatusUnprocessableEntity, "text/plain", "", apperr.InvalidInput, "422 invalid zipcode"},
+		{http.StatusNotFound, "text/plain", "404 can not find zipcode", apperr.NotFound, "404 can not find zipcode"},
+		{http.StatusTooManyRequests, "text/plain", "slow down", apperr.RateLimited, "slow down"},
+		{http.StatusInternalServerError, "text/plain", "", apperr.UpstreamUnavailable, "tempByCep answered 500 Internal Server Error"},
+		{http.StatusGatewayTimeout, "text/plain", "weatherapi did not answer", apperr.UpstreamTimeout, "weatherapi did not answer"},
+		{http.StatusServiceUnavailable, apperr.ProblemContentType,
+			`{"type":"urn:problem-type:otel-cep:misconfigured","title":"misconfigured","status":503,"detail":"weatherapi key is not configured"}`,
+			apperr.Misconfigured, "weatherapi key is not configured"},
+	}
+	for _, tt := range tests {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		withFakeTempByCep(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		})
+
+		_, err := GetTempByCep(context.Background(), "20541155")
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("GetTempByCep() returned %v for %d, expected %v", err, tt.status, tt.kind)
+		}
+		if detail := apperr.Message(err); detail != tt.detail {
+			t.Errorf("GetTempByCep() returned detail %q for %d, expected %q", detail, tt.status, tt.detail)
+		}
+
+		spans := recorder.Ended()
+		if len(spans) != 1 {
+			t.Fatalf("GetTempByCep() ended %d spans", len(spans))
+		}
+		var status attribute.Value
+		for _, attr := range spans[0].Attributes() {
+			if attr.Key == "http.response.status_code" {
+				status = attr.Value
+			}
+		}
+		if status.AsInt64() != int64(tt.status) {
+			t.Errorf("GetTempByCep() recorded status %v, expected %d", status.Emit(), tt.status)
+		}
+	}
+}
+
+func withFakeTempByCep(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previousUrl, previousTimeout, previousProvider := tempByCepUrl, requestExpirationTime, otel.GetTracerProvider()
+	tempByCepUrl, requestExpirationTime = server.URL, time.Second
+	t.Cleanup(func() {
+		server.Close()
+		tempByCepUrl, requestExpirationTime = previousUrl, previousTimeout
+		otel.SetTracerProvider(previousProvider)
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JonecoBoy/otel-cep/inputApp/pkg/external"
+	"github.com/JonecoBoy/otel-cep/inputApp/pkg/utils"
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// forecastQuery são os parâmetros repassados ao tempByCep
+var forecastQuery = []string{"days", "hourly"}
+
+// forecastHandler repassa a previsão do tempByCep: GET /forecast/{cep}?days=N&hourly=true
+func forecastHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("weather").Start(ctx, "forecastHandler")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(ctx, w, r, apperr.New(apperr.MethodNotAllowed, "only GET is allowed"))
+		return
+	}
+	cep := strings.ReplaceAll(strings.TrimPrefix(r.URL.Path, "/forecast/"), "-", "")
+	if validateCep(cep) != nil {
+		writeError(ctx, w, r, utils.InvalidZipError)
+		return
+	}
+
+	query := url.Values{}
+	for _, name := range forecastQuery {
+		if r.URL.Query().Has(name) {
+			query.Set(name, r.URL.Query().Get(name))
+		}
+	}
+	forecast, err := external.GetForecastByCep(ctx, cep, query)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forecast)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/inputApp/pkg/external"
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+)
+
+func TestForecastHandlerForwardsToTempByCep(t *testing.T) {
+	var path, query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		w.Write([]byte(`{"city":"Rio de Janeiro","days":[{"date":"2024-05-01","min":{"c":18,"f":64.4,"k":291},"chance_of_rain":80}]}`))
+	}))
+	defer server.Close()
+	external.Configure(external.Settings{TempByCepURL: server.URL, RequestTimeout: time.Second})
+
+	recorder := httptest.NewRecorder()
+	forecastHandler(recorder, httptest.NewRequest(http.MethodGet, "/forecast/20541-155?days=1&hourly=true&other=1", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("forecastHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if path != "/forecast/20541155" || query != "days=1&hourly=true" {
+		t.Errorf("forecastHandler() called tempByCep at %s?%s", path, query)
+	}
+	var forecast external.ForecastByCepResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &forecast)
+	if err != nil {
+		t.Fatalf("forecastHandler() answered an invalid body: %v", err)
+	}
+	if forecast.City != "Rio de Janeiro" || len(forecast.Days) != 1 || forecast.Days[0].Min.K != 291 {
+		t.Errorf("forecastHandler() answered %+v", forecast)
+	}
+}
+
+func TestForecastHandlerErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apperr.Write(r.Context(), w, r, apperr.New(apperr.InvalidInput, "days should be between 1 and 14"))
+	}))
+	defer server.Close()
+	external.Configure(external.Settings{TempByCepURL: server.URL, RequestTimeout: time.Second})
+
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{http.MethodGet, "/forecast/123", http.StatusUnprocessableEntity},
+		{http.MethodPost, "/forecast/20541155", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/forecast/20541155?days=20", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		forecastHandler(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+		if recorder.Code != tt.status {
+			t.Errorf("forecastHandler() answered %d for %s %s, expected %d", recorder.Code, tt.method, tt.target, tt.status)
+		}
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/JonecoBoy/otel-cep/inputApp/pkg/config"
 	"github.com/JonecoBoy/otel-cep/inputApp/pkg/external"
 	"github.com/JonecoBoy/otel-cep/inputApp/pkg/infra/telemetry"
 	"github.com/JonecoBoy/otel-cep/inputApp/pkg/utils"
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"log"
 	"net"
 	"net/http"
@@ -31,21 +35,54 @@ type TempResponse struct {
 	Temp_K float32 `json:"temp_k"`
 }
 
+// TempRequest is the body of POST /, either a single cep or a batch of ceps.
+type TempRequest struct {
+	Cep  *string  `json:"cep"`
+	Ceps []string `json:"ceps"`
+}
+
+type BatchItem struct {
+	Index int             `json:"index"`
+	Cep   string          `json:"cep"`
+	Temp  *TempResponse   `json:"temp,omitempty"`
+	Error *apperr.Problem `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchItem `json:"results"`
+}
+
+// batchTimeout substitui o WriteTimeout do servidor nos batches
+var batchTimeout = 60 * time.Second
+
 func main() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	shutdown, err := telemetry.SetupProvider(ctx, "inputApp")
+	// sem config válida o serviço nem sobe
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("config:\n%s", cfg)
+	external.Configure(external.Settings{
+		TempByCepURL:   cfg.TempByCep.BaseURL,
+		RequestTimeout: time.Duration(cfg.TempByCep.RequestTimeout),
+		BatchTimeout:   time.Duration(cfg.TempByCep.BatchTimeout),
+	})
+	batchTimeout = time.Duration(cfg.TempByCep.BatchTimeout)
+
+	shutdown, err := telemetry.SetupProvider(ctx, "inputApp", cfg.CollectorAddr)
 	if err != nil {
 		return
 	}
 
 	srv := &http.Server{
-		Addr:         ":8091",
+		Addr:         ":" + strconv.Itoa(cfg.Port),
 		BaseContext:  func(_ net.Listener) context.Context { return ctx },
 		ReadTimeout:  time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
 		Handler:      mainHttpHanlder(),
 	}
 	defer func() {
@@ -88,6 +125,7 @@ func mainHttpHanlder() http.Handler {
 
 	mux.Handle("/metrics", promhttp.Handler())
 	handleFunc("/", tempHandler)
+	handleFunc("/forecast/", forecastHandler)
 	//handler := otelhttp.NewHandler(mux, "/")
 	return mux
 }
@@ -114,49 +152,39 @@ func tempHandler(w http.ResponseWriter, r *http.Request) {
 	defer span.End()
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(ctx, w, r, apperr.New(apperr.MethodNotAllowed, "only POST is allowed"))
 		return
 	}
-	var body map[string]string
+	var body TempRequest
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
-		http.Error(w, "Error decoding JSON", http.StatusBadRequest)
+		writeError(ctx, w, r, apperr.Wrap(apperr.MalformedRequest, err, "error decoding JSON"))
+		return
+	}
+
+	if body.Ceps != nil {
+		tempBatch(ctx, w, r, body.Ceps)
 		return
 	}
 
 	// Get the cep from the body
-	cep, ok := body["cep"]
-	if !ok {
-		http.Error(w, "cep not provided", http.StatusBadRequest)
+	if body.Cep == nil {
+		writeError(ctx, w, r, apperr.New(apperr.MalformedRequest, "cep not provided"))
 		return
 	}
 	// remove separator if exists
-	cep = strings.ReplaceAll(cep, "-", "")
+	cep := strings.ReplaceAll(*body.Cep, "-", "")
 	err = validateCep(cep)
 	if err != nil {
-		w.WriteHeader(utils.InvalidZipError.Code) // 422
-		w.Write([]byte(utils.InvalidZipError.Message))
+		writeError(ctx, w, r, utils.InvalidZipError)
 		return
 	}
 
 	c, err := external.GetTempByCep(ctx, cep)
 	if err != nil {
-		if err.Error() == "422 invalid zipcode" {
-			w.WriteHeader(http.StatusUnprocessableEntity) // 422
-		}
-		if err.Error() == "404 can not find zipcode" {
-			w.WriteHeader(http.StatusUnprocessableEntity) // 404
-		}
-
-		w.Write([]byte(err.Error()))
-		return
-	}
-
-	if err != nil {
-		fmt.Println(err.Error())
-		w.Write([]byte(err.Error()))
+		writeError(ctx, w, r, err)
 		return
-
 	}
 
 	// Set the Content-Type header to application/json
@@ -171,11 +199,176 @@ func tempHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	jsonData, err := json.Marshal(tempResponse)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(ctx, w, r, err)
 		return
 	}
 
 	log.Print(string(jsonData))
 	w.Write(jsonData)
 }
+
+// writeError answers with a problem document for err and records it on the span of ctx.
+func writeError(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	log.Print(err)
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, apperr.Message(err))
+	apperr.Write(ctx, w, r, err)
+}
+
+// tempBatch valida cada CEP e manda os válidos, sem repetição, em um único batch para o tempByCep.
+func tempBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, ceps []string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("batch.size", len(ceps)))
+	if len(ceps) == 0 {
+		writeError(ctx, w, r, apperr.New(apperr.InvalidInput, "ceps must not be empty"))
+		return
+	}
+	// sem suporte (ex: httptest) continua valendo o WriteTimeout do servidor
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(batchTimeout))
+
+	batch := newBatch(ctx, ceps)
+	if acceptsNDJSON(r) {
+		streamBatch(ctx, w, r, batch)
+		return
+	}
+
+	if len(batch.valid) > 0 {
+		items, err := external.GetTempByCepBatch(ctx, batch.valid)
+		if err != nil {
+			writeError(ctx, w, r, err)
+			return
+		}
+		for position, item := range items {
+			batch.resolve(position, item)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchResponse{Results: batch.results})
+}
+
+// batch guarda a resposta de cada CEP pedido e quais CEPs válidos vão para o tempByCep.
+type batch struct {
+	results []BatchItem
+	// valid são os CEPs válidos sem repetição, indexes diz onde cada um aparece no pedido
+	valid   []string
+	indexes [][]int
+}
+
+func newBatch(ctx context.Context, ceps []string) *batch {
+	b := &batch{results: make([]BatchItem, len(ceps))}
+	positions := map[string]int{}
+	for i, raw := range ceps {
+		cep := strings.ReplaceAll(strings.TrimSpace(raw), "-", "")
+		b.results[i] = BatchItem{Index: i, Cep: cep}
+		if validateCep(cep) != nil {
+			problem := apperr.NewProblem(ctx, nil, utils.InvalidZipError)
+			b.results[i].Cep = raw
+			b.results[i].Error = &problem
+			continue
+		}
+		position, seen := positions[cep]
+		if !seen {
+			position = len(b.valid)
+			positions[cep] = position
+			b.valid = append(b.valid, cep)
+			b.indexes = append(b.indexes, nil)
+		}
+		b.indexes[position] = append(b.indexes[position], i)
+	}
+	return b
+}
+
+// resolve fills every requested index of the valid CEP at position with the answer of tempByCep.
+func (b *batch) resolve(position int, item external.TempByCepBatchItem) []BatchItem {
+	if position < 0 || position >= len(b.indexes) {
+		return nil
+	}
+	var resolved []BatchItem
+	for _, i := range b.indexes[position] {
+		b.results[i].Error = item.Error
+		if item.Temp != nil {
+			b.results[i].Temp = &TempResponse{
+				City:   item.Temp.City,
+				Temp_C: item.Temp.Temp_C,
+				Temp_F: item.Temp.Temp_F,
+				Temp_K: item.Temp.Temp_K,
+			}
+		}
+		resolved = append(resolved, b.results[i])
+	}
+	return resolved
+}
+
+// streamBatch escreve uma linha NDJSON por CEP assim que o tempByCep responde,
+// os CEPs inválidos saem logo na primeira leva.
+func streamBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, b *batch) {
+	span := trace.SpanFromContext(ctx)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(ctx, w, r, apperr.New(apperr.Misconfigured, "streaming is not supported"))
+		return
+	}
+
+	// ao desconectar o cliente a request ao tempByCep é cancelada junto
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	write := func(items ...BatchItem) error {
+		for _, item := range items {
+			err := encoder.Encode(item)
+			if err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	var invalid []BatchItem
+	for _, item := range b.results {
+		if item.Error != nil {
+			invalid = append(invalid, item)
+		}
+	}
+	err := write(invalid...)
+	if err != nil || len(b.valid) == 0 {
+		return
+	}
+
+	answered := make([]bool, len(b.valid))
+	err = external.StreamTempByCepBatch(ctx, b.valid, func(item external.TempByCepBatchItem) error {
+		if item.Index >= 0 && item.Index < len(answered) {
+			answered[item.Index] = true
+		}
+		return write(b.resolve(item.Index, item)...)
+	})
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	// o tempByCep falhou no meio, os CEPs que faltaram recebem o erro dele
+	span.RecordError(err)
+	problem := apperr.NewProblem(ctx, nil, err)
+	for position, done := range answered {
+		if !done {
+			write(b.resolve(position, external.TempByCepBatchItem{Error: &problem})...)
+		}
+	}
+}
+
+const ndjsonContentType = "application/x-ndjson"
+
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if strings.TrimSpace(mediaType) == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/inputApp/pkg/external"
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
 )
 
 func TestShouldReturnInvalidZipCode(t *testing.T) {
@@ -30,3 +40,185 @@ func TestShouldReturnValidZip(t *testing.T) {
 		t.Errorf("InputApp() invalid zip code")
 	}
 }
+
+func TestTempHandlerErrorStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		cep      string
+		upstream int
+		status   int
+	}{
+		{"invalid", "123", http.StatusOK, http.StatusUnprocessableEntity},
+		{"not found", "99900028", http.StatusNotFound, http.StatusNotFound},
+		{"unavailable", "20541155", http.StatusInternalServerError, http.StatusBadGateway},
+		{"rate limited", "20541155", http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{"timeout", "20541155", http.StatusGatewayTimeout, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.upstream)
+			}))
+			defer server.Close()
+			external.Configure(external.Settings{TempByCepURL: server.URL, RequestTimeout: time.Second})
+
+			recorder := httptest.NewRecorder()
+			tempHandler(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"cep":"`+tt.cep+`"}`)))
+
+			if recorder.Code != tt.status {
+				t.Errorf("tempHandler() answered %d, expected %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestTempHandlerPropagatesUpstreamProblem(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apperr.Write(r.Context(), w, r, apperr.New(apperr.RateLimited, "weatherapi quota exceeded"))
+	}))
+	defer server.Close()
+	external.Configure(external.Settings{TempByCepURL: server.URL, RequestTimeout: time.Second})
+
+	recorder := httptest.NewRecorder()
+	tempHandler(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"cep":"20541155"}`)))
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("tempHandler() answered %d, expected %d", recorder.Code, http.StatusTooManyRequests)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != apperr.ProblemContentType {
+		t.Errorf("tempHandler() answered Content-Type %q", contentType)
+	}
+	var problem apperr.Problem
+	err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+	if err != nil {
+		t.Fatalf("tempHandler() answered an invalid problem: %v", err)
+	}
+	if problem.Type != apperr.RateLimited.Type() || problem.Detail != "weatherapi quota exceeded" || problem.Instance != "/" {
+		t.Errorf("tempHandler() answered %+v", problem)
+	}
+}
+
+func TestTempHandlerBatch(t *testing.T) {
+	var forwarded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/temp/batch" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			Ceps []string `json:"ceps"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		forwarded = body.Ceps
+
+		notFound := apperr.NewProblem(r.Context(), nil, apperr.New(apperr.NotFound, "404 can not find zipcode"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []external.TempByCepBatchItem{
+			{Index: 0, Cep: "20541155", Temp: &external.TempByCepResponse{City: "Rio de Janeiro", Temp_C: 25}},
+			{Index: 1, Cep: "99900028", Error: &notFound},
+		}})
+	}))
+	defer server.Close()
+	external.Configure(external.Settings{TempByCepURL: server.URL, RequestTimeout: time.Second, BatchTimeout: time.Second})
+
+	recorder := httptest.NewRecorder()
+	tempHandler(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"ceps":["20541-155","123","99900028","20541155"]}`)))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("tempHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if strings.Join(forwarded, ",") != "20541155,99900028" {
+		t.Errorf("tempHandler() forwarded %v, expected the valid CEPs without repetition", forwarded)
+	}
+	var response BatchResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if len(response.Results) != 4 {
+		t.Fatalf("tempHandler() answered %d items, expected 4", len(response.Results))
+	}
+	results := response.Results
+	if results[0].Temp == nil || results[0].Temp.City != "Rio de Janeiro" || results[3].Temp == nil {
+		t.Errorf("tempHandler() did not answer the resolved CEPs: %+v", results)
+	}
+	if results[1].Error == nil || results[1].Error.Status != http.StatusUnprocessableEntity {
+		t.Errorf("tempHandler() did not reject the invalid CEP: %+v", results[1])
+	}
+	if results[2].Error == nil || results[2].Error.Status != http.StatusNotFound {
+		t.Errorf("tempHandler() did not answer the upstream error: %+v", results[2])
+	}
+}
+
+func postStream(t *testing.T, ctx context.Context, body string) *http.Response {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(tempHandler))
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, strings.NewReader(body))
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST / returned an error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestTempHandlerBatchStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/x-ndjson" {
+			t.Errorf("tempHandler() did not ask tempByCep for a stream")
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		encoder.Encode(external.TempByCepBatchItem{Index: 1, Cep: "99900028", Temp: &external.TempByCepResponse{City: "Mage"}})
+		w.(http.Flusher).Flush()
+		encoder.Encode(external.TempByCepBatchItem{Index: 0, Cep: "20541155", Temp: &external.TempByCepResponse{City: "Rio de Janeiro"}})
+	}))
+	defer upstream.Close()
+	external.Configure(external.Settings{TempByCepURL: upstream.URL, RequestTimeout: time.Second, BatchTimeout: time.Second})
+
+	resp := postStream(t, context.Background(), `{"ceps":["20541155","123","99900028","20541-155"]}`)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("tempHandler() answered Content-Type %q", contentType)
+	}
+
+	var cities []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var item BatchItem
+		json.Unmarshal(scanner.Bytes(), &item)
+		city := "error"
+		if item.Temp != nil {
+			city = item.Temp.City
+		}
+		cities = append(cities, fmt.Sprintf("%d:%s", item.Index, city))
+	}
+	// o inválido sai primeiro, depois a ordem em que o tempByCep respondeu, repetidos juntos
+	expected := "1:error,2:Mage,0:Rio de Janeiro,3:Rio de Janeiro"
+	if strings.Join(cities, ",") != expected {
+		t.Errorf("tempHandler() streamed %v, expected %s", cities, expected)
+	}
+}
+
+func TestTempHandlerBatchStreamCancelledOnDisconnect(t *testing.T) {
+	cancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer upstream.Close()
+	external.Configure(external.Settings{TempByCepURL: upstream.URL, RequestTimeout: time.Second, BatchTimeout: 10 * time.Second})
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	resp := postStream(t, ctx, `{"ceps":["123","20541155"]}`)
+	line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+	if err != nil || !strings.Contains(string(line), `"index":0`) {
+		t.Fatalf("tempHandler() streamed %q, %v", line, err)
+	}
+	disconnect()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("tempHandler() did not cancel the tempByCep request after the client disconnected")
+	}
+}
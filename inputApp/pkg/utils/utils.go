@@ -7,6 +7,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 )
@@ -14,6 +15,7 @@ import (
 type HttpError struct {
 	Code    int
 	Message string
+	Kind    *apperr.Kind
 }
 
 // Error implements error.
@@ -25,14 +27,21 @@ func (e HttpError) Error() string {
 	return e.Message
 }
 
+// Unwrap lets errors.Is(err, apperr.NotFound) match the predefined errors below.
+func (e HttpError) Unwrap() error {
+	return e.Kind
+}
+
 var InvalidZipError = HttpError{
 	Code:    http.StatusUnprocessableEntity,
 	Message: "422 invalid zipcode",
+	Kind:    apperr.InvalidInput,
 }
 
 var ZipNotFoundError = HttpError{
 	Code:    http.StatusNotFound,
 	Message: "404 can not find zipcode",
+	Kind:    apperr.NotFound,
 }
 
 func ValidateCep(cep string) error {
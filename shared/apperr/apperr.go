@@ -0,0 +1,207 @@
+package apperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Kind classifies an error and decides the HTTP status it is answered with.
+// Kinds are compared with errors.Is, so any error wrapping a Kind matches it.
+type Kind struct {
+	name   string
+	status int
+}
+
+func (k *Kind) Error() string {
+	return k.name
+}
+
+func (k *Kind) Name() string {
+	return k.name
+}
+
+func (k *Kind) Status() int {
+	return k.status
+}
+
+// Type is the problem type URI of the kind, like urn:problem-type:otel-cep:not-found.
+func (k *Kind) Type() string {
+	return typePrefix + strings.ReplaceAll(k.name, " ", "-")
+}
+
+const typePrefix = "urn:problem-type:otel-cep:"
+
+var (
+	InvalidInput        = &Kind{name: "invalid input", status: http.StatusUnprocessableEntity}
+	NotFound            = &Kind{name: "not found", status: http.StatusNotFound}
+	UpstreamTimeout     = &Kind{name: "upstream timeout", status: http.StatusGatewayTimeout}
+	UpstreamUnavailable = &Kind{name: "upstream unavailable", status: http.StatusBadGateway}
+	RateLimited         = &Kind{name: "rate limited", status: http.StatusTooManyRequests}
+	Misconfigured       = &Kind{name: "misconfigured", status: http.StatusServiceUnavailable}
+	// erros do próprio request HTTP, antes de qualquer regra de negócio
+	MalformedRequest = &Kind{name: "malformed request", status: http.StatusBadRequest}
+	Unauthorized     = &Kind{name: "unauthorized", status: http.StatusUnauthorized}
+	MethodNotAllowed = &Kind{name: "method not allowed", status: http.StatusMethodNotAllowed}
+)
+
+var kinds = []*Kind{
+	InvalidInput, NotFound, UpstreamTimeout, UpstreamUnavailable, RateLimited, Misconfigured,
+	MalformedRequest, Unauthorized, MethodNotAllowed,
+}
+
+// Error is a classified error, Message is safe to show to clients and Err keeps the cause.
+type Error struct {
+	Kind    *Kind
+	Message string
+	Err     error
+}
+
+func New(kind *Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Wrap(kind *Kind, err error, message string) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap exposes both the Kind and the cause to errors.Is and errors.As.
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// KindOf returns the Kind of err, nil when it was never classified.
+func KindOf(err error) *Kind {
+	var kind *Kind
+	if errors.As(err, &kind) {
+		return kind
+	}
+	return nil
+}
+
+// Status returns the HTTP status for err, 500 when it was never classified.
+func Status(err error) int {
+	if kind := KindOf(err); kind != nil {
+		return kind.Status()
+	}
+	return http.StatusInternalServerError
+}
+
+// Message returns the message of the outermost Error, or the error text itself.
+func Message(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return err.Error()
+}
+
+// internalDetail substitui o texto de erros não classificados, que pode ter urls e detalhes internos
+const internalDetail = "internal error"
+
+// Detail is what clients see of err: the message of a classified error, a generic text otherwise.
+// The raw error of an unclassified failure belongs in the logs and on the span only.
+func Detail(err error) string {
+	if KindOf(err) == nil {
+		return internalDetail
+	}
+	return Message(err)
+}
+
+// ProblemContentType is the media type of RFC 7807 problem documents.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document. A Problem read from another
+// service is also an error of the kind named by its type.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	TraceID  string `json:"trace_id,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Detail
+}
+
+// Unwrap exposes the kind of the problem, looked up by type and then by status.
+func (p *Problem) Unwrap() error {
+	for _, kind := range kinds {
+		if kind.Type() == p.Type {
+			return kind
+		}
+	}
+	for _, kind := range kinds {
+		if kind.status == p.Status {
+			return kind
+		}
+	}
+	return nil
+}
+
+// NewProblem describes err for the request r, ctx carries the span whose trace id is reported.
+func NewProblem(ctx context.Context, r *http.Request, err error) Problem {
+	p := Problem{
+		Type:   "about:blank",
+		Status: Status(err),
+		Detail: Detail(err),
+	}
+	p.Title = http.StatusText(p.Status)
+	if kind := KindOf(err); kind != nil {
+		p.Type = kind.Type()
+		p.Title = kind.Name()
+	}
+	if r != nil {
+		p.Instance = r.URL.RequestURI()
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		p.TraceID = spanContext.TraceID().String()
+	}
+	return p
+}
+
+// Write answers the request with the status of err and a problem document describing it.
+func Write(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	p := NewProblem(ctx, r, err)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// ReadProblem decodes the problem document of a failed response, it returns
+// nil when the body is not a problem so the caller can fall back to the status.
+func ReadProblem(resp *http.Response) *Problem {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != ProblemContentType {
+		return nil
+	}
+	var p Problem
+	err := json.NewDecoder(resp.Body).Decode(&p)
+	if err != nil {
+		return nil
+	}
+	if p.Status == 0 {
+		p.Status = resp.StatusCode
+	}
+	return &p
+}
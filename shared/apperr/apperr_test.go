@@ -0,0 +1,132 @@
+package apperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestErrorsIsMatchesKindAndCause(t *testing.T) {
+	err := fmt.Errorf("viaCEP: %w", Wrap(UpstreamTimeout, context.DeadlineExceeded, "no answer"))
+
+	if !errors.Is(err, UpstreamTimeout) {
+		t.Errorf("errors.Is() did not match the kind")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("errors.Is() did not match the cause")
+	}
+	if errors.Is(err, NotFound) {
+		t.Errorf("errors.Is() matched another kind")
+	}
+	if KindOf(err) != UpstreamTimeout {
+		t.Errorf("KindOf() = %v, expected %v", KindOf(err), UpstreamTimeout)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{New(InvalidInput, "invalid zipcode"), http.StatusUnprocessableEntity},
+		{New(NotFound, "can not find zipcode"), http.StatusNotFound},
+		{Wrap(UpstreamTimeout, context.DeadlineExceeded, "timeout"), http.StatusGatewayTimeout},
+		{New(UpstreamUnavailable, "down"), http.StatusBadGateway},
+		{New(RateLimited, "slow down"), http.StatusTooManyRequests},
+		{New(Misconfigured, "missing key"), http.StatusServiceUnavailable},
+		{errors.New("unclassified"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if status := Status(tt.err); status != tt.status {
+			t.Errorf("Status(%v) = %d, expected %d", tt.err, status, tt.status)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	recorder := httptest.NewRecorder()
+	Write(ctx, recorder, httptest.NewRequest(http.MethodGet, "/cep/99900028?x=1", nil),
+		fmt.Errorf("lookup: %w", New(NotFound, "can not find zipcode")))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Write() wrote status %d", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Errorf("Write() wrote Content-Type %q", contentType)
+	}
+	var p Problem
+	err := json.Unmarshal(recorder.Body.Bytes(), &p)
+	if err != nil {
+		t.Fatalf("Write() wrote an invalid body: %v", err)
+	}
+	expected := Problem{
+		Type:     "urn:problem-type:otel-cep:not-found",
+		Title:    "not found",
+		Status:   http.StatusNotFound,
+		Detail:   "can not find zipcode",
+		Instance: "/cep/99900028?x=1",
+		TraceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+	}
+	if p != expected {
+		t.Errorf("Write() wrote %+v, expected %+v", p, expected)
+	}
+}
+
+func TestWriteUnclassified(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := fmt.Errorf("unmarshalling response body: %w", errors.New("invalid character '<' looking for beginning of value"))
+	Write(context.Background(), recorder, httptest.NewRequest(http.MethodGet, "/temp/1", nil), err)
+
+	var p Problem
+	json.Unmarshal(recorder.Body.Bytes(), &p)
+	if p.Type != "about:blank" || p.Status != http.StatusInternalServerError || p.TraceID != "" {
+		t.Errorf("Write() wrote %+v", p)
+	}
+	// o texto do erro fica só no log e no span
+	if p.Detail != "internal error" {
+		t.Errorf("Write() leaked the unclassified error in the detail: %q", p.Detail)
+	}
+}
+
+func TestReadProblem(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Write(context.Background(), recorder, httptest.NewRequest(http.MethodGet, "/temp/1", nil),
+		Wrap(RateLimited, errors.New("quota"), "weatherapi quota exceeded"))
+
+	p := ReadProblem(recorder.Result())
+	if p == nil {
+		t.Fatalf("ReadProblem() did not read the problem")
+	}
+	if !errors.Is(p, RateLimited) {
+		t.Errorf("ReadProblem() returned a problem of kind %v", KindOf(p))
+	}
+	if p.Error() != "weatherapi quota exceeded" {
+		t.Errorf("ReadProblem() returned detail %q", p.Error())
+	}
+
+	plain := httptest.NewRecorder()
+	plain.WriteHeader(http.StatusNotFound)
+	plain.Write([]byte("404 page not found"))
+	if ReadProblem(plain.Result()) != nil {
+		t.Errorf("ReadProblem() read a problem from a plain body")
+	}
+}
+
+func TestProblemKindFallsBackToStatus(t *testing.T) {
+	p := &Problem{Type: "about:blank", Status: http.StatusGatewayTimeout}
+	if KindOf(p) != UpstreamTimeout {
+		t.Errorf("KindOf() = %v, expected %v", KindOf(p), UpstreamTimeout)
+	}
+}
@@ -0,0 +1,136 @@
+// Package configload fills a config struct from an optional YAML file and the env vars named by its `env` tags.
+// It is shared by tempByCep and inputApp so both read their config the same way.
+package configload
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration read as "10s", "1m30s"... from YAML and env.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// Load fills cfg (a pointer to a struct with defaults already set) from the optional
+// YAML file and then from the env vars named by the `env` tags, env wins.
+func Load(cfg interface{}, file string) error {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading config file: %w", err)
+		}
+		err = yaml.Unmarshal(data, cfg)
+		if err != nil {
+			return fmt.Errorf("parsing config file %s: %w", file, err)
+		}
+	}
+	return loadEnv(reflect.ValueOf(cfg).Elem())
+}
+
+func loadEnv(v reflect.Value) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		structField := v.Type().Field(i)
+
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			errs = append(errs, loadEnv(field))
+			continue
+		}
+
+		name := structField.Tag.Get("env")
+		value, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			continue
+		}
+		err := setField(field, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed.Nanoseconds())
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
+
+// Format lists every field of cfg as "env=value", one per line, fields tagged secret:"true" are redacted.
+func Format(cfg interface{}) string {
+	return format(reflect.Indirect(reflect.ValueOf(cfg)))
+}
+
+func format(v reflect.Value) string {
+	var lines []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		structField := v.Type().Field(i)
+
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			lines = append(lines, format(field))
+			continue
+		}
+
+		value := fmt.Sprint(field.Interface())
+		if structField.Tag.Get("secret") == "true" {
+			value = redact(value)
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", structField.Tag.Get("env"), value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func redact(value string) string {
+	if value == "" {
+		return "<empty>"
+	}
+	return "<redacted>"
+}
@@ -0,0 +1,75 @@
+package configload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Name   string `yaml:"name" env:"CONFIGLOAD_NAME"`
+	Token  string `yaml:"token" env:"CONFIGLOAD_TOKEN" secret:"true"`
+	Nested struct {
+		Size    int      `yaml:"size" env:"CONFIGLOAD_SIZE"`
+		Enabled bool     `yaml:"enabled" env:"CONFIGLOAD_ENABLED"`
+		Timeout Duration `yaml:"timeout" env:"CONFIGLOAD_TIMEOUT"`
+	} `yaml:"nested"`
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte(`
+name: file
+nested:
+  size: 3
+  timeout: 5s
+`), 0o644)
+	// env vence o arquivo
+	t.Setenv("CONFIGLOAD_TIMEOUT", "2s")
+	t.Setenv("CONFIGLOAD_ENABLED", "true")
+
+	cfg := testConfig{Token: "default"}
+	err := Load(&cfg, file)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if cfg.Name != "file" || cfg.Token != "default" || cfg.Nested.Size != 3 || !cfg.Nested.Enabled {
+		t.Errorf("Load() did not merge defaults, file and env: %+v", cfg)
+	}
+	if time.Duration(cfg.Nested.Timeout) != 2*time.Second {
+		t.Errorf("Load() did not let env override the file: %s", cfg.Nested.Timeout)
+	}
+}
+
+func TestLoadReportsEveryInvalidEnv(t *testing.T) {
+	t.Setenv("CONFIGLOAD_SIZE", "three")
+	t.Setenv("CONFIGLOAD_TIMEOUT", "5")
+
+	var cfg testConfig
+	err := Load(&cfg, "")
+	if err == nil {
+		t.Fatalf("Load() accepted invalid env vars")
+	}
+	for _, name := range []string{"CONFIGLOAD_SIZE", "CONFIGLOAD_TIMEOUT"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Load() error does not mention %s: %v", name, err)
+		}
+	}
+}
+
+func TestFormatRedactsSecrets(t *testing.T) {
+	cfg := testConfig{Name: "svc", Token: "s3cr3t"}
+	cfg.Nested.Timeout = Duration(time.Minute)
+
+	out := Format(cfg)
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("Format() printed a secret: %s", out)
+	}
+	for _, line := range []string{"CONFIGLOAD_NAME=svc", "CONFIGLOAD_TOKEN=<redacted>", "CONFIGLOAD_TIMEOUT=1m0s"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Format() does not list %s: %s", line, out)
+		}
+	}
+}
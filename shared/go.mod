@@ -0,0 +1,10 @@
+module github.com/JonecoBoy/otel-cep/shared
+
+go 1.21
+
+require (
+	go.opentelemetry.io/otel/trace v1.27.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require go.opentelemetry.io/otel v1.27.0 // indirect
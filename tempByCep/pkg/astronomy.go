@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// astronomyWeather é trocado nos testes
+var astronomyWeather = external.AstronomyWeather
+
+// AstronomyResponse has the sun and moon times of a day as ISO-8601 timestamps in the time zone of the city.
+// A time is null when it does not happen that day, like a moonrise after midnight.
+type AstronomyResponse struct {
+	City             string     `json:"city"`
+	Date             string     `json:"date"`
+	TzID             string     `json:"tz_id"`
+	Sunrise          *time.Time `json:"sunrise"`
+	Sunset           *time.Time `json:"sunset"`
+	Moonrise         *time.Time `json:"moonrise"`
+	Moonset          *time.Time `json:"moonset"`
+	MoonPhase        string     `json:"moon_phase"`
+	MoonIllumination float64    `json:"moon_illumination"`
+}
+
+// astronomyHandler devolve sol e lua da cidade do CEP: GET /astronomy/{cep}?date=YYYY-MM-DD
+func astronomyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("forecast").Start(ctx, "astronomyHandler")
+	defer span.End()
+
+	cep, err := pathCep(r, "/astronomy/")
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	// sem date vale o dia de hoje na cidade
+	date := r.URL.Query().Get("date")
+	if date != "" {
+		date, err = readDate(r)
+		if err != nil {
+			writeError(ctx, w, r, err)
+			return
+		}
+	}
+	span.SetAttributes(attribute.String("cep", cep), attribute.String("astronomy.date", date))
+
+	astronomy, err := resolveAstronomy(ctx, cep, date)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(astronomy)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// resolveAstronomy busca o endereço do CEP e os horários de sol e lua da cidade.
+func resolveAstronomy(ctx context.Context, cep string, date string) (AstronomyResponse, error) {
+	c, err := CachedCepConcurrency(ctx, cep)
+	if err != nil {
+		return AstronomyResponse{}, err
+	}
+
+	astronomy, err := astronomyWeather(ctx, weatherQuery(ctx, c), date)
+	if err != nil {
+		return AstronomyResponse{}, err
+	}
+	if date == "" {
+		date, _, _ = strings.Cut(astronomy.Location.Localtime, " ")
+	}
+	return newAstronomyResponse(astronomy, date)
+}
+
+func newAstronomyResponse(astronomy external.Astronomy, date string) (AstronomyResponse, error) {
+	zone, err := external.LocationZone(astronomy.Location)
+	if err != nil {
+		return AstronomyResponse{}, err
+	}
+	day, err := time.ParseInLocation("2006-01-02", date, zone)
+	if err != nil {
+		return AstronomyResponse{}, apperr.Wrap(apperr.UpstreamUnavailable, err, "weatherapi answered an invalid date")
+	}
+
+	astro := astronomy.Astronomy.Astro
+	response := AstronomyResponse{
+		City:             astronomy.Location.Name,
+		Date:             date,
+		TzID:             astronomy.Location.TzID,
+		MoonPhase:        astro.MoonPhase,
+		MoonIllumination: astro.MoonIllumination,
+	}
+	times := []struct {
+		clock string
+		field **time.Time
+	}{
+		{astro.Sunrise, &response.Sunrise},
+		{astro.Sunset, &response.Sunset},
+		{astro.Moonrise, &response.Moonrise},
+		{astro.Moonset, &response.Moonset},
+	}
+	for _, t := range times {
+		*t.field, err = astroTime(day, t.clock)
+		if err != nil {
+			return AstronomyResponse{}, err
+		}
+	}
+	return response, nil
+}
+
+// astroTime junta o dia com um horário da WeatherAPI como "06:12 AM", "No moonrise" vira nil
+func astroTime(day time.Time, clock string) (*time.Time, error) {
+	if strings.HasPrefix(clock, "No ") || clock == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse("3:04 PM", clock)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "weatherapi answered an invalid time "+clock)
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), parsed.Hour(), parsed.Minute(), 0, 0, day.Location())
+	return &t, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+func fakeAstronomy() external.Astronomy {
+	return external.Astronomy{
+		Location: &external.Location{Name: "Rio de Janeiro", TzID: "America/Sao_Paulo", Localtime: "2024-05-01 23:30"},
+		Astronomy: &external.AstronomyBase{Astro: &external.Astro{
+			Sunrise:          "06:12 AM",
+			Sunset:           "05:24 PM",
+			Moonrise:         "No moonrise",
+			Moonset:          "01:05 PM",
+			MoonPhase:        "Waning Crescent",
+			MoonIllumination: 38,
+		}},
+	}
+}
+
+func getAstronomy(t *testing.T, target string, fetch func(ctx context.Context, query string, date string) (external.Astronomy, error)) *httptest.ResponseRecorder {
+	t.Helper()
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "20541155", City: "Rio de Janeiro", State: "RJ"}})
+	previous := astronomyWeather
+	astronomyWeather = fetch
+	t.Cleanup(func() { astronomyWeather = previous })
+
+	recorder := httptest.NewRecorder()
+	astronomyHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func TestAstronomyHandlerAnswersISOTimes(t *testing.T) {
+	var requested string
+	recorder := getAstronomy(t, "/astronomy/20541-155?date=2024-05-02", func(ctx context.Context, query string, date string) (external.Astronomy, error) {
+		requested = date
+		return fakeAstronomy(), nil
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("astronomyHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if requested != "2024-05-02" {
+		t.Errorf("astronomyHandler() asked WeatherAPI for %q", requested)
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`"date":"2024-05-02"`,
+		`"sunrise":"2024-05-02T06:12:00-03:00"`,
+		`"sunset":"2024-05-02T17:24:00-03:00"`,
+		`"moonrise":null`,
+		`"moonset":"2024-05-02T13:05:00-03:00"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("astronomyHandler() answered %s, expected %s", body, expected)
+		}
+	}
+}
+
+func TestAstronomyHandlerDefaultsToLocationToday(t *testing.T) {
+	recorder := getAstronomy(t, "/astronomy/20541155", func(ctx context.Context, query string, date string) (external.Astronomy, error) {
+		if date != "" {
+			t.Errorf("astronomyHandler() asked WeatherAPI for %q, expected today at the city", date)
+		}
+		return fakeAstronomy(), nil
+	})
+
+	var response AstronomyResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("astronomyHandler() answered an invalid body: %s", recorder.Body)
+	}
+	if response.Date != "2024-05-01" || response.Sunrise.Format("2006-01-02 15:04") != "2024-05-01 06:12" {
+		t.Errorf("astronomyHandler() answered %+v", response)
+	}
+}
+
+func TestAstronomyHandlerRejectsDate(t *testing.T) {
+	recorder := getAstronomy(t, "/astronomy/20541155?date=02/05/2024", func(ctx context.Context, query string, date string) (external.Astronomy, error) {
+		t.Errorf("astronomyHandler() called WeatherAPI for an invalid date")
+		return external.Astronomy{}, nil
+	})
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("astronomyHandler() answered %d, expected %d", recorder.Code, http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchMaxSize é o máximo de CEPs aceitos em um único batch
+var batchMaxSize = 500
+
+// batchConcurrency é quantos CEPs de um batch são resolvidos ao mesmo tempo
+var batchConcurrency = 8
+
+// batchTimeout é o prazo de um batch inteiro, maior que o WriteTimeout do servidor
+var batchTimeout = 60 * time.Second
+
+// ndjsonContentType é pedido no Accept para receber o batch em streaming
+const ndjsonContentType = "application/x-ndjson"
+
+type BatchRequest struct {
+	Ceps []string `json:"ceps"`
+}
+
+// BatchItem is the answer for the CEP at Index of the request, with either Temp or Error set.
+type BatchItem struct {
+	Index int             `json:"index"`
+	Cep   string          `json:"cep"`
+	Temp  *TempResponse   `json:"temp,omitempty"`
+	Error *apperr.Problem `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchItem `json:"results"`
+}
+
+// tempBatchHandler resolve vários CEPs de uma vez: POST /temp/batch {"ceps": [...]}
+func tempBatchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("temp").Start(ctx, "tempBatchHandler")
+	defer span.End()
+
+	ceps, err := readBatchRequest(w, r)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, batchTimeout)
+	defer cancel()
+	// sem suporte (ex: httptest) continua valendo o WriteTimeout do servidor
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(batchTimeout))
+
+	if acceptsNDJSON(r) {
+		streamBatch(ctx, w, r, ceps)
+		return
+	}
+
+	results := make([]BatchItem, len(ceps))
+	failed := 0
+	for item := range resolveBatch(ctx, ceps) {
+		if item.Error != nil {
+			failed++
+		}
+		results[item.Index] = item
+	}
+	span.SetAttributes(
+		attribute.Int("batch.size", len(ceps)),
+		attribute.Int("batch.failed", failed),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchResponse{Results: results})
+}
+
+// streamBatch writes one NDJSON line per CEP as soon as it is resolved, in completion order.
+// When the client goes away the pending lookups are cancelled with ctx.
+func streamBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, ceps []string) {
+	span := trace.SpanFromContext(ctx)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(ctx, w, r, apperr.New(apperr.Misconfigured, "streaming is not supported"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	written, failed := 0, 0
+	for item := range resolveBatch(ctx, ceps) {
+		err := encoder.Encode(item)
+		if err != nil {
+			// o cliente desconectou, o resto do batch é cancelado
+			span.RecordError(err)
+			cancel()
+			break
+		}
+		flusher.Flush()
+		written++
+		if item.Error != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(
+		attribute.Bool("batch.streamed", true),
+		attribute.Int("batch.size", len(ceps)),
+		attribute.Int("batch.written", written),
+		attribute.Int("batch.failed", failed),
+	)
+}
+
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if strings.TrimSpace(mediaType) == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// readBatchRequest decodes and checks the body of a batch request.
+func readBatchRequest(w http.ResponseWriter, r *http.Request) ([]string, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return nil, apperr.New(apperr.MethodNotAllowed, "only POST is allowed")
+	}
+	var body BatchRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.MalformedRequest, err, "error decoding JSON")
+	}
+	if len(body.Ceps) == 0 {
+		return nil, apperr.New(apperr.InvalidInput, "ceps must not be empty")
+	}
+	if len(body.Ceps) > batchMaxSize {
+		return nil, apperr.New(apperr.InvalidInput, fmt.Sprintf("at most %d ceps are accepted per batch, got %d", batchMaxSize, len(body.Ceps)))
+	}
+	return body.Ceps, nil
+}
+
+// resolveBatch resolves the CEPs with at most batchConcurrency lookups at a time and sends
+// one item per CEP, in completion order. A CEP repeated in the batch is resolved only once.
+// The channel is closed after the last item, cancelling ctx makes the pending CEPs fail fast.
+func resolveBatch(ctx context.Context, ceps []string) <-chan BatchItem {
+	// buffer para que os workers nunca fiquem presos se ninguém mais ler
+	items := make(chan BatchItem, len(ceps))
+
+	indexes := map[string][]int{}
+	var unique []string
+	for i, raw := range ceps {
+		cep := strings.ReplaceAll(strings.TrimSpace(raw), "-", "")
+		if utils.ValidateCep(cep) != nil {
+			items <- batchItem(ctx, i, raw, TempResponse{}, utils.InvalidZipError)
+			continue
+		}
+		if _, seen := indexes[cep]; !seen {
+			unique = append(unique, cep)
+		}
+		indexes[cep] = append(indexes[cep], i)
+	}
+
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		for n, cep := range unique {
+			select {
+			case jobs <- cep:
+			case <-ctx.Done():
+				for _, cep := range unique[n:] {
+					cancelBatchCep(ctx, cep, indexes[cep], items)
+				}
+				return
+			}
+		}
+	}()
+
+	workers := min(batchConcurrency, len(unique))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cep := range jobs {
+				if ctx.Err() != nil {
+					cancelBatchCep(ctx, cep, indexes[cep], items)
+					continue
+				}
+				resolveBatchCep(ctx, cep, indexes[cep], items)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(items)
+	}()
+	return items
+}
+
+func resolveBatchCep(ctx context.Context, cep string, indexes []int, items chan<- BatchItem) {
+	ctx, span := otel.Tracer("temp").Start(ctx, "batch-temp")
+	defer span.End()
+	span.SetAttributes(attribute.String("cep", cep), attribute.IntSlice("batch.indexes", indexes))
+
+	temp, err := resolveTemp(ctx, cep)
+	if err != nil {
+		if apperr.KindOf(err) == nil && ctx.Err() != nil {
+			err = apperr.Wrap(apperr.UpstreamTimeout, err, "batch did not finish in time")
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, apperr.Message(err))
+	}
+	for _, i := range indexes {
+		items <- batchItem(ctx, i, cep, temp, err)
+	}
+}
+
+// cancelBatchCep answers a CEP that was not resolved because ctx is done.
+func cancelBatchCep(ctx context.Context, cep string, indexes []int, items chan<- BatchItem) {
+	err := apperr.Wrap(apperr.UpstreamTimeout, ctx.Err(), "batch did not finish in time")
+	for _, i := range indexes {
+		items <- batchItem(ctx, i, cep, TempResponse{}, err)
+	}
+}
+
+func batchItem(ctx context.Context, index int, cep string, temp TempResponse, err error) BatchItem {
+	item := BatchItem{Index: index, Cep: cep}
+	if err != nil {
+		problem := apperr.NewProblem(ctx, nil, err)
+		item.Error = &problem
+		return item
+	}
+	item.Temp = &temp
+	return item
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
+)
+
+// concurrencyCepProvider guarda quantas consultas rodaram ao mesmo tempo.
+type concurrencyCepProvider struct {
+	calls  *atomic.Int32
+	active *atomic.Int32
+	peak   *atomic.Int32
+}
+
+func (p concurrencyCepProvider) Name() string {
+	return "concurrency"
+}
+
+func (p concurrencyCepProvider) Lookup(ctx context.Context, cep string) (external.Address, error) {
+	p.calls.Add(1)
+	active := p.active.Add(1)
+	defer p.active.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if active <= peak || p.peak.CompareAndSwap(peak, active) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if cep == "99900028" {
+		return external.Address{}, utils.ZipNotFoundError
+	}
+	return external.Address{Cep: cep, City: "Rio de Janeiro", State: "RJ"}, nil
+}
+
+func withBatchProvider(t *testing.T) concurrencyCepProvider {
+	t.Helper()
+	provider := concurrencyCepProvider{calls: &atomic.Int32{}, active: &atomic.Int32{}, peak: &atomic.Int32{}}
+	withEmptyCepCache(t)
+	withRaceMode(t, FirstSuccess)
+	withCepProviders(t, provider)
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+	return provider
+}
+
+func postBatch(body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	tempBatchHandler(recorder, httptest.NewRequest(http.MethodPost, "/temp/batch", strings.NewReader(body)))
+	return recorder
+}
+
+func TestTempBatchHandlerAnswersEveryItem(t *testing.T) {
+	provider := withBatchProvider(t)
+
+	recorder := postBatch(`{"ceps":["20541-155","123","99900028","20541155"]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("tempBatchHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	var response BatchResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("tempBatchHandler() answered an invalid body: %v", err)
+	}
+	if len(response.Results) != 4 {
+		t.Fatalf("tempBatchHandler() answered %d items, expected 4", len(response.Results))
+	}
+	for i, item := range response.Results {
+		if item.Index != i {
+			t.Errorf("item %d has index %d", i, item.Index)
+		}
+	}
+
+	results := response.Results
+	if results[0].Temp == nil || results[0].Temp.Temp_C != 25 || results[3].Temp == nil {
+		t.Errorf("tempBatchHandler() did not resolve the valid CEPs: %+v", results)
+	}
+	if results[1].Error == nil || results[1].Error.Type != apperr.InvalidInput.Type() {
+		t.Errorf("tempBatchHandler() did not reject the invalid CEP: %+v", results[1])
+	}
+	if results[2].Error == nil || results[2].Error.Status != http.StatusNotFound {
+		t.Errorf("tempBatchHandler() did not report the unknown CEP: %+v", results[2])
+	}
+	// 20541-155 e 20541155 são o mesmo CEP
+	if provider.calls.Load() != 2 {
+		t.Errorf("the provider was called %d times, expected 2", provider.calls.Load())
+	}
+}
+
+func TestTempBatchHandlerBoundsConcurrency(t *testing.T) {
+	provider := withBatchProvider(t)
+	previous := batchConcurrency
+	batchConcurrency = 2
+	t.Cleanup(func() { batchConcurrency = previous })
+
+	recorder := postBatch(`{"ceps":["20541151","20541152","20541153","20541154","20541155","20541156"]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("tempBatchHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if provider.calls.Load() != 6 {
+		t.Errorf("the provider was called %d times, expected 6", provider.calls.Load())
+	}
+	if peak := provider.peak.Load(); peak > 2 {
+		t.Errorf("%d lookups ran at the same time, expected at most 2", peak)
+	}
+}
+
+func TestTempBatchHandlerRejectsRequest(t *testing.T) {
+	withBatchProvider(t)
+	previous := batchMaxSize
+	batchMaxSize = 2
+	t.Cleanup(func() { batchMaxSize = previous })
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"malformed", http.MethodPost, `{"ceps":`, http.StatusBadRequest},
+		{"empty", http.MethodPost, `{"ceps":[]}`, http.StatusUnprocessableEntity},
+		{"too big", http.MethodPost, `{"ceps":["20541151","20541152","20541153"]}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			tempBatchHandler(recorder, httptest.NewRequest(tt.method, "/temp/batch", strings.NewReader(tt.body)))
+			if recorder.Code != tt.status {
+				t.Errorf("tempBatchHandler() answered %d, expected %d", recorder.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestResolveBatchCancelled(t *testing.T) {
+	withEmptyCepCache(t)
+	inFlight := cancelRecorderProvider{cancelled: make(chan struct{})}
+	withCepProviders(t, inFlight)
+	previous := batchConcurrency
+	batchConcurrency = 1
+	t.Cleanup(func() { batchConcurrency = previous })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	items := resolveBatch(ctx, []string{"20541151", "20541152", "20541153"})
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	received := 0
+	for item := range items {
+		received++
+		if item.Error == nil {
+			t.Errorf("item %d resolved after the cancellation", item.Index)
+		}
+	}
+	if received != 3 {
+		t.Errorf("resolveBatch() sent %d items, expected 3", received)
+	}
+	// a consulta em andamento também precisa ser cancelada, não só abandonada
+	select {
+	case <-inFlight.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("resolveBatch() did not cancel the lookup in flight")
+	}
+}
+
+// delayedCepProvider demora um tempo diferente para cada CEP.
+type delayedCepProvider struct {
+	delays map[string]time.Duration
+}
+
+func (p delayedCepProvider) Name() string {
+	return "delayed"
+}
+
+func (p delayedCepProvider) Lookup(ctx context.Context, cep string) (external.Address, error) {
+	select {
+	case <-time.After(p.delays[cep]):
+	case <-ctx.Done():
+		return external.Address{}, ctx.Err()
+	}
+	return external.Address{Cep: cep, City: "Rio de Janeiro", State: "RJ"}, nil
+}
+
+func postBatchStream(t *testing.T, ctx context.Context, body string) *http.Response {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(tempBatchHandler))
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/temp/batch", strings.NewReader(body))
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /temp/batch returned an error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestTempBatchHandlerStreamsInCompletionOrder(t *testing.T) {
+	withEmptyCepCache(t)
+	withCepProviders(t, delayedCepProvider{delays: map[string]time.Duration{
+		"20541151": 200 * time.Millisecond,
+		"20541152": 0,
+	}})
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+
+	resp := postBatchStream(t, context.Background(), `{"ceps":["20541151","20541152","123"]}`)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("tempBatchHandler() answered Content-Type %q", contentType)
+	}
+
+	var order []int
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var item BatchItem
+		err := json.Unmarshal(scanner.Bytes(), &item)
+		if err != nil {
+			t.Fatalf("tempBatchHandler() streamed an invalid line %q: %v", scanner.Text(), err)
+		}
+		order = append(order, item.Index)
+	}
+	// o CEP inválido e o rápido chegam antes do lento
+	if len(order) != 3 || order[2] != 0 {
+		t.Errorf("tempBatchHandler() streamed the indexes %v, expected the slow CEP 0 last", order)
+	}
+}
+
+func TestTempBatchHandlerStreamCancelledOnDisconnect(t *testing.T) {
+	withEmptyCepCache(t)
+	inFlight := cancelRecorderProvider{cancelled: make(chan struct{})}
+	withCepProviders(t, inFlight)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	resp := postBatchStream(t, ctx, `{"ceps":["123","20541155"]}`)
+
+	// a linha do CEP inválido chega antes do CEP que nunca responde
+	line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+	if err != nil || !strings.Contains(string(line), `"index":0`) {
+		t.Fatalf("tempBatchHandler() streamed %q, %v", line, err)
+	}
+	disconnect()
+
+	select {
+	case <-inFlight.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("tempBatchHandler() did not cancel the lookup after the client disconnected")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/geo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// lookupIP é trocado nos testes
+var lookupIP = external.LookupIP
+
+// trustedProxies são os únicos remetentes cujo X-Forwarded-For é lido, vazio ignora o header
+var trustedProxies []netip.Prefix
+
+// IPTempResponse is the TempResponse of where WeatherAPI locates the client's address.
+type IPTempResponse struct {
+	TempResponse
+	IP      string  `json:"ip"`
+	Region  string  `json:"region"`
+	Country string  `json:"country"`
+	Lat     float32 `json:"lat"`
+	Lon     float32 `json:"lon"`
+}
+
+// tempByIPHandler devolve a temperatura de onde está o cliente, pelo endereço dele: GET /temp/by-ip
+func tempByIPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("temp").Start(ctx, "tempByIPHandler")
+	defer span.End()
+
+	addr, err := clientIP(r)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.String("client.address", addr.String()))
+
+	temp, err := resolveTempByIP(ctx, addr)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(temp)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// clientIP is the address that connected to us or, when it is a trusted proxy, the last address
+// in X-Forwarded-For that is not a trusted proxy. Entries left of it may be forged by the client.
+func clientIP(r *http.Request) (netip.Addr, error) {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("reading remote address %q: %w", r.RemoteAddr, err)
+	}
+	addr := remote.Addr().Unmap()
+
+	// o header é lido da direita para a esquerda: cada proxy confiável acrescenta quem conectou nele
+	var forwarded []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0 && trustedProxy(addr); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			return netip.Addr{}, apperr.Wrap(apperr.MalformedRequest, err, "X-Forwarded-For has an invalid address")
+		}
+		addr = hop.Unmap()
+	}
+	return addr, nil
+}
+
+func trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTempByIP localiza o endereço na WeatherAPI e consulta o tempo pela coordenada, que é compartilhada
+// no cache por todos os endereços da mesma cidade.
+func resolveTempByIP(ctx context.Context, addr netip.Addr) (IPTempResponse, error) {
+	location, err := lookupIP(ctx, addr.String())
+	if err != nil {
+		return IPTempResponse{}, err
+	}
+
+	point := geo.Point{Lat: float64(location.Lat), Lon: float64(location.Lon)}
+	temp, err := CachedCurrentWeather(ctx, coordinatesQuery(point), "pt")
+	if err != nil {
+		return IPTempResponse{}, err
+	}
+	return IPTempResponse{
+		TempResponse: newTempResponse(temp),
+		IP:           addr.String(),
+		Region:       location.Region,
+		Country:      location.CountryName,
+		Lat:          location.Lat,
+		Lon:          location.Lon,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+// withTrustedProxies troca os proxies confiáveis durante o teste.
+func withTrustedProxies(t *testing.T, prefixes ...string) {
+	t.Helper()
+	previous := trustedProxies
+	trustedProxies = nil
+	for _, prefix := range prefixes {
+		trustedProxies = append(trustedProxies, netip.MustParsePrefix(prefix))
+	}
+	t.Cleanup(func() { trustedProxies = previous })
+}
+
+// withFakeLookupIP troca a localização por IP da WeatherAPI durante o teste.
+func withFakeLookupIP(t *testing.T, lookup func(ctx context.Context, ipaddress string) (external.IP, error)) {
+	t.Helper()
+	previous := lookupIP
+	lookupIP = lookup
+	t.Cleanup(func() { lookupIP = previous })
+}
+
+func TestClientIP(t *testing.T) {
+	withTrustedProxies(t, "10.0.0.0/8", "2001:db8::/32")
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		expected  string
+	}{
+		{"direct", "200.160.2.3:5000", nil, "200.160.2.3"},
+		{"untrusted sender", "200.160.2.3:5000", []string{"1.2.3.4"}, "200.160.2.3"},
+		{"trusted proxy", "10.0.0.5:5000", []string{"200.160.2.3"}, "200.160.2.3"},
+		{"forged entry left of the client", "10.0.0.5:5000", []string{"1.2.3.4, 200.160.2.3"}, "200.160.2.3"},
+		{"chain of trusted proxies", "10.0.0.5:5000", []string{"200.160.2.3, 10.0.0.9", "10.1.1.1"}, "200.160.2.3"},
+		{"ipv6 proxy and client", "[2001:db8::1]:5000", []string{"2804:14c::1"}, "2804:14c::1"},
+		{"mapped ipv4", "[::ffff:10.0.0.5]:5000", []string{" ::ffff:200.160.2.3 "}, "200.160.2.3"},
+		{"only proxies", "10.0.0.5:5000", []string{"10.0.0.7"}, "10.0.0.7"},
+		{"trusted proxy without header", "10.0.0.5:5000", nil, "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/temp/by-ip", nil)
+		r.RemoteAddr = tt.remote
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		addr, err := clientIP(r)
+		if err != nil || addr.String() != tt.expected {
+			t.Errorf("%s: clientIP() returned %v, %v, expected %s", tt.name, addr, err, tt.expected)
+		}
+	}
+}
+
+func TestClientIPRejectsInvalidForwardedAddress(t *testing.T) {
+	withTrustedProxies(t, "10.0.0.0/8")
+
+	r := httptest.NewRequest(http.MethodGet, "/temp/by-ip", nil)
+	r.RemoteAddr = "10.0.0.5:5000"
+	r.Header.Set("X-Forwarded-For", "unknown")
+	_, err := clientIP(r)
+	if !errors.Is(err, apperr.MalformedRequest) {
+		t.Errorf("clientIP() returned %v, expected %v", err, apperr.MalformedRequest)
+	}
+
+	// o header de quem não é proxy nem é lido
+	r.RemoteAddr = "200.160.2.3:5000"
+	addr, err := clientIP(r)
+	if err != nil || addr.String() != "200.160.2.3" {
+		t.Errorf("clientIP() returned %v, %v for an untrusted sender", addr, err)
+	}
+}
+
+func TestTempByIPHandler(t *testing.T) {
+	withTrustedProxies(t, "10.0.0.0/8")
+	var located, query string
+	withFakeLookupIP(t, func(ctx context.Context, ipaddress string) (external.IP, error) {
+		located = ipaddress
+		return external.IP{IP: ipaddress, City: "Rio de Janeiro", Region: "Rio de Janeiro", CountryName: "Brazil", Lat: -22.9, Lon: -43.23}, nil
+	})
+	withFakeWeather(t, func(ctx context.Context, q string, lang string) (external.CurrentModel, error) {
+		query = q
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/temp/by-ip", nil)
+	r.RemoteAddr = "10.0.0.5:5000"
+	r.Header.Set("X-Forwarded-For", "200.160.2.3")
+	recorder := httptest.NewRecorder()
+	tempByIPHandler(recorder, r)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("tempByIPHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if located != "200.160.2.3" || query != "-22.9000,-43.2300" {
+		t.Errorf("tempByIPHandler() located %q and asked the weather of %q", located, query)
+	}
+	var response IPTempResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("tempByIPHandler() answered an invalid body: %v", err)
+	}
+	if response.IP != "200.160.2.3" || response.Country != "Brazil" || response.Temp_C != 25 || response.Temp_K != 298 {
+		t.Errorf("tempByIPHandler() answered %+v", response)
+	}
+}
+
+func TestTempByIPHandlerPrivateAddress(t *testing.T) {
+	withTrustedProxies(t)
+	withFakeLookupIP(t, func(ctx context.Context, ipaddress string) (external.IP, error) {
+		return external.IP{}, apperr.New(apperr.InvalidInput, ipaddress+" is not a public ip address")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/temp/by-ip", nil)
+	r.RemoteAddr = "192.168.0.10:5000"
+	recorder := httptest.NewRecorder()
+	tempByIPHandler(recorder, r)
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("tempByIPHandler() answered %d, expected %d", recorder.Code, http.StatusUnprocessableEntity)
+	}
+}
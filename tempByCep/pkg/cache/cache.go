@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// métricas expostas no /metrics, separadas pelo nome do cache
+var (
+	lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tempbycep_cache_lookups_total",
+		Help: "Cache lookups partitioned by cache name and result (hit or miss).",
+	}, []string{"cache", "result"})
+	evictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tempbycep_cache_evictions_total",
+		Help: "Entries evicted because the cache reached its max entries.",
+	}, []string{"cache"})
+	coalesced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tempbycep_cache_coalesced_loads_total",
+		Help: "Cache loads whose upstream call was shared between concurrent callers.",
+	}, []string{"cache"})
+	entries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tempbycep_cache_entries",
+		Help: "Entries currently stored in the cache.",
+	}, []string{"cache"})
+)
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// Cache is an in memory LRU cache where every entry has its own TTL.
+// It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	name       string
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+	calls map[K]*call[V]
+
+	// now é trocado nos testes
+	now func() time.Time
+}
+
+// New creates a cache identified by name on the metrics, maxEntries <= 0 means unbounded.
+func New[K comparable, V any](name string, maxEntries int) *Cache[K, V] {
+	return &Cache[K, V]{
+		name:       name,
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[K]*list.Element),
+		calls:      make(map[K]*call[V]),
+		now:        time.Now,
+	}
+}
+
+// Get returns the value stored for key if it has not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.get(key)
+	if ok {
+		lookups.WithLabelValues(c.name, "hit").Inc()
+	} else {
+		lookups.WithLabelValues(c.name, "miss").Inc()
+	}
+	return value, ok
+}
+
+func (c *Cache[K, V]) get(key K) (V, bool) {
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.removeElement(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Update replaces the value stored for key with update(value), keeping its expiration. It reports
+// false when key is not cached. Unlike Get it is not counted as a lookup on the metrics.
+func (c *Cache[K, V]) Update(key K, update func(V) V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.removeElement(el)
+		return false
+	}
+	e.value = update(e.value)
+	return true
+}
+
+// Set stores value for key during ttl, evicting the least recently used entry if needed.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		e := el.Value.(*entry[K, V])
+		e.value = value
+		e.expiresAt = expiresAt
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+		evictions.WithLabelValues(c.name).Inc()
+	}
+	entries.WithLabelValues(c.name).Set(float64(c.ll.Len()))
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+	entries.WithLabelValues(c.name).Set(float64(c.ll.Len()))
+}
+
+// LoadResult tells how a value returned by Load was obtained.
+type LoadResult struct {
+	// Hit is true when the value came from the cache.
+	Hit bool
+	// Shared is true when the value came from a load started by another caller.
+	Shared bool
+}
+
+// call is a load in progress, shared by every caller waiting for the same key.
+type call[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Load returns the cached value for key, or calls load and caches what it returns for the given ttl.
+// Concurrent calls for the same key share a single call to load. Errors are never cached,
+// callers that want negative caching should return the negative answer as a value.
+//
+// The shared load runs without the cancellation of ctx so one caller giving up does not fail
+// the others, each caller stops waiting as soon as its own ctx is done and the load itself
+// is cancelled once every caller waiting for it has given up.
+func (c *Cache[K, V]) Load(ctx context.Context, key K, load func(ctx context.Context) (V, time.Duration, error)) (V, LoadResult, error) {
+	if value, ok := c.Get(key); ok {
+		return value, LoadResult{Hit: true}, nil
+	}
+	return c.Reload(ctx, key, load)
+}
+
+// Reload works like Load but always calls load, replacing what is cached for key.
+// It is used to refresh entries that are still cached but no longer fresh.
+func (c *Cache[K, V]) Reload(ctx context.Context, key K, load func(ctx context.Context) (V, time.Duration, error)) (V, LoadResult, error) {
+	c.mu.Lock()
+	cl, shared := c.calls[key]
+	if !shared {
+		loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cl = &call[V]{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = cl
+		go c.run(loadCtx, key, cl, load)
+	}
+	cl.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		if shared {
+			coalesced.WithLabelValues(c.name).Inc()
+		}
+		return cl.value, LoadResult{Shared: shared}, cl.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		cl.waiters--
+		if cl.waiters == 0 {
+			// ninguém mais espera por essa consulta, quem chegar depois começa outra
+			cl.cancel()
+			if c.calls[key] == cl {
+				delete(c.calls, key)
+			}
+		}
+		c.mu.Unlock()
+		var zero V
+		return zero, LoadResult{}, ctx.Err()
+	}
+}
+
+func (c *Cache[K, V]) run(ctx context.Context, key K, cl *call[V], load func(ctx context.Context) (V, time.Duration, error)) {
+	defer cl.cancel()
+	value, ttl, err := load(ctx)
+	if err == nil && ctx.Err() == nil {
+		c.Set(key, value, ttl)
+	}
+
+	c.mu.Lock()
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+	c.mu.Unlock()
+
+	cl.value, cl.err = value, err
+	close(cl.done)
+}
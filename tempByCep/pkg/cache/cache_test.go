@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheExpiresEntries(t *testing.T) {
+	c := New[string, int]("test-ttl", 0)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Set("a", 1, time.Minute)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get() = %v, %v, expected 1, true", v, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get() returned an expired entry")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, expired entry was not removed", c.Len())
+	}
+}
+
+func TestCacheUpdateKeepsExpiration(t *testing.T) {
+	c := New[string, int]("test-update", 0)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if c.Update("a", func(v int) int { return v + 1 }) {
+		t.Errorf("Update() changed a key that is not cached")
+	}
+	c.Set("a", 1, time.Minute)
+	now = now.Add(30 * time.Second)
+	if !c.Update("a", func(v int) int { return v + 1 }) {
+		t.Fatalf("Update() did not find a cached key")
+	}
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Errorf("Get() = %v, %v after Update(), expected 2, true", v, ok)
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Update() extended the expiration of the entry")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int]("test-lru", 2)
+
+	c.Set("a", 1, time.Hour)
+	c.Set("b", 2, time.Hour)
+	c.Get("a") // "b" passa a ser o menos usado
+	c.Set("c", 3, time.Hour)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Get() returned the least recently used entry")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Get(%s) missed a recently used entry", key)
+		}
+	}
+}
+
+func TestCacheLoadCoalescesConcurrentCalls(t *testing.T) {
+	c := New[string, int]("test-load", 0)
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	load := func(ctx context.Context) (int, time.Duration, error) {
+		calls.Add(1)
+		<-release
+		return 42, time.Hour, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, err := c.Load(context.Background(), "key", load)
+			if err != nil || v != 42 {
+				t.Errorf("Load() = %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("load was called %d times, expected 1", calls.Load())
+	}
+
+	_, result, _ := c.Load(context.Background(), "key", load)
+	if !result.Hit {
+		t.Errorf("Load() did not hit the cache after loading")
+	}
+}
+
+func TestCacheLoadDoesNotCacheErrors(t *testing.T) {
+	c := New[string, int]("test-errors", 0)
+	failure := errors.New("upstream down")
+
+	_, _, err := c.Load(context.Background(), "key", func(ctx context.Context) (int, time.Duration, error) {
+		return 0, time.Hour, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Load() returned %v, expected %v", err, failure)
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Errorf("Load() cached an error")
+	}
+}
+
+func TestCacheLoadHonorsCallerContext(t *testing.T) {
+	c := New[string, int]("test-ctx", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := c.Load(ctx, "key", func(ctx context.Context) (int, time.Duration, error) {
+		time.Sleep(time.Second)
+		return 1, time.Hour, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Load() returned %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestCacheLoadCancelledWhenEveryCallerGivesUp(t *testing.T) {
+	c := New[string, int]("test-cancel", 0)
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	load := func(ctx context.Context) (int, time.Duration, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return 0, 0, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, ctx := range []context.Context{first, second} {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			c.Load(ctx, "key", load)
+		}(ctx)
+	}
+	<-started
+
+	cancelFirst()
+	select {
+	case <-cancelled:
+		t.Fatalf("the load was cancelled while a caller was still waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("the load was not cancelled after every caller gave up")
+	}
+	wg.Wait()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/cache"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/store"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// cepCacheEntry guarda também os CEPs inexistentes (cache negativo).
+type cepCacheEntry struct {
+	Address  external.Address
+	NotFound bool
+}
+
+var cepCache = cache.New[string, cepCacheEntry]("cep", 10000)
+
+// um CEP quase nunca muda de endereço, já um CEP inexistente pode ser criado
+var cepCacheTTL = 24 * time.Hour
+var cepCacheNegativeTTL = 10 * time.Minute
+
+// CachedCepConcurrency puts the cep cache in front of CepConcurrency.
+// Concurrent lookups for the same CEP share a single race between the providers.
+func CachedCepConcurrency(ctx context.Context, cep string) (external.Address, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("cep").Start(ctx, "cached-cep")
+	defer span.End()
+
+	// o formato é validado antes para não cachear lixo
+	cep = strings.ReplaceAll(cep, "-", "")
+	err := utils.ValidateCep(cep)
+	if err != nil {
+		return external.Address{}, utils.InvalidZipError
+	}
+
+	entry, result, err := cepCache.Load(ctx, cep, func(ctx context.Context) (cepCacheEntry, time.Duration, error) {
+		address, err := CepConcurrency(ctx, cep)
+		if errors.Is(err, utils.ZipNotFoundError) {
+			return cepCacheEntry{NotFound: true}, cepCacheNegativeTTL, nil
+		}
+		if err != nil && ctx.Err() != nil {
+			// todos que esperavam desistiram, não há para quem responder
+			return cepCacheEntry{}, 0, err
+		}
+		if err != nil {
+			// com os providers fora do ar o último endereço conhecido ainda serve,
+			// mas fica pouco tempo no cache para voltar a consultar logo
+			stored, ok := storedAddress(span, cep)
+			if ok {
+				return cepCacheEntry{Address: stored}, cepCacheNegativeTTL, nil
+			}
+			return cepCacheEntry{}, 0, err
+		}
+		address = locateAddress(ctx, address)
+		storeAddress(span, cep, address)
+		return cepCacheEntry{Address: address}, cepCacheTTL, nil
+	})
+	span.SetAttributes(
+		attribute.Bool("cep.cache.hit", result.Hit),
+		attribute.Bool("cep.cache.shared", result.Shared),
+		attribute.Bool("cep.cache.negative", entry.NotFound),
+	)
+	if err != nil {
+		return external.Address{}, err
+	}
+	if entry.NotFound {
+		return external.Address{}, utils.ZipNotFoundError
+	}
+	return entry.Address, nil
+}
+
+// cepStore é opcional, nil quando CEP_STORE_PATH não foi definido
+var cepStore store.CepStore
+
+func storeAddress(span trace.Span, cep string, address external.Address) {
+	if cepStore == nil {
+		return
+	}
+	err := cepStore.Put(cep, address)
+	if err != nil {
+		log.Printf("storing cep %s: %v", cep, err)
+		span.RecordError(err)
+	}
+}
+
+func storedAddress(span trace.Span, cep string) (external.Address, bool) {
+	if cepStore == nil {
+		return external.Address{}, false
+	}
+	address, ok, err := cepStore.Get(cep)
+	if err != nil {
+		log.Printf("reading cep %s from store: %v", cep, err)
+		span.RecordError(err)
+		return external.Address{}, false
+	}
+	span.SetAttributes(attribute.Bool("cep.store.fallback", ok))
+	return address, ok
+}
+
+// warmUpCepCache carrega no cache de memória os CEPs persistidos.
+func warmUpCepCache() error {
+	if cepStore == nil {
+		return nil
+	}
+	addresses, err := cepStore.All()
+	if err != nil {
+		return err
+	}
+	for cep, address := range addresses {
+		cepCache.Set(cep, cepCacheEntry{Address: address}, cepCacheTTL)
+	}
+	log.Printf("cep cache warmed up with %d addresses", len(addresses))
+	return nil
+}
+
+// PurgeCep removes a CEP from the store and from the memory cache.
+func PurgeCep(cep string) error {
+	cep = store.NormalizeCep(cep)
+	cepCache.Delete(cep)
+	if cepStore == nil {
+		return nil
+	}
+	return cepStore.Delete(cep)
+}
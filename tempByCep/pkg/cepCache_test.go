@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/cache"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/store"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
+)
+
+// countingCepProvider conta quantas vezes foi consultado.
+type countingCepProvider struct {
+	calls *atomic.Int32
+	err   error
+}
+
+func (p countingCepProvider) Name() string {
+	return "counting"
+}
+
+func (p countingCepProvider) Lookup(ctx context.Context, cep string) (external.Address, error) {
+	p.calls.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	if p.err != nil {
+		return external.Address{}, p.err
+	}
+	return external.Address{Cep: cep, Source: "counting"}, nil
+}
+
+// withEmptyCepCache isola o cache de CEP durante o teste.
+func withEmptyCepCache(t *testing.T) {
+	t.Helper()
+	previous := cepCache
+	cepCache = cache.New[string, cepCacheEntry]("cep-test", 100)
+	t.Cleanup(func() { cepCache = previous })
+}
+
+func TestCachedCepConcurrencyCoalescesLookups(t *testing.T) {
+	withEmptyCepCache(t)
+	var calls atomic.Int32
+	withCepProviders(t, countingCepProvider{calls: &calls})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := CachedCepConcurrency(context.Background(), "20541-155")
+			if err != nil || result.Cep != "20541155" {
+				t.Errorf("CachedCepConcurrency() = %v, %v", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := CachedCepConcurrency(context.Background(), "20541155"); err != nil {
+		t.Fatalf("CachedCepConcurrency() returned an error: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("the provider was called %d times, expected 1", calls.Load())
+	}
+}
+
+func TestCachedCepConcurrencyNegativeCache(t *testing.T) {
+	withEmptyCepCache(t)
+	var calls atomic.Int32
+	withCepProviders(t, countingCepProvider{calls: &calls, err: utils.ZipNotFoundError})
+
+	for i := 0; i < 3; i++ {
+		_, err := CachedCepConcurrency(context.Background(), "90541155")
+		if err != utils.ZipNotFoundError {
+			t.Fatalf("CachedCepConcurrency() returned %v, expected %v", err, utils.ZipNotFoundError)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("the provider was called %d times, expected 1", calls.Load())
+	}
+}
+
+func TestCachedCepConcurrencyDoesNotCacheFailures(t *testing.T) {
+	withEmptyCepCache(t)
+	var calls atomic.Int32
+	withCepProviders(t, countingCepProvider{calls: &calls, err: errors.New("connection refused")})
+
+	for i := 0; i < 2; i++ {
+		if _, err := CachedCepConcurrency(context.Background(), "20541155"); err == nil {
+			t.Fatalf("CachedCepConcurrency() did not return an error")
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("the provider was called %d times, expected 2", calls.Load())
+	}
+}
+
+// withCepStore usa um FileCepStore temporário durante o teste.
+func withCepStore(t *testing.T) *store.FileCepStore {
+	t.Helper()
+	s, err := store.OpenFileCepStore(filepath.Join(t.TempDir(), "ceps.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := cepStore
+	cepStore = s
+	t.Cleanup(func() {
+		cepStore = previous
+		s.Close()
+	})
+	return s
+}
+
+func TestCachedCepConcurrencyFallsBackToStore(t *testing.T) {
+	withEmptyCepCache(t)
+	s := withCepStore(t)
+	s.Put("20541155", external.Address{Cep: "20541155", City: "Rio de Janeiro", Source: "ViaCEP"})
+	var calls atomic.Int32
+	withCepProviders(t, countingCepProvider{calls: &calls, err: errors.New("connection refused")})
+
+	result, err := CachedCepConcurrency(context.Background(), "20541155")
+	if err != nil {
+		t.Fatalf("CachedCepConcurrency() returned an error: %v", err)
+	}
+	if result.City != "Rio de Janeiro" {
+		t.Errorf("CachedCepConcurrency() returned %v", result)
+	}
+}
+
+func TestCachedCepConcurrencyPersistsAddresses(t *testing.T) {
+	withEmptyCepCache(t)
+	s := withCepStore(t)
+	var calls atomic.Int32
+	withCepProviders(t, countingCepProvider{calls: &calls})
+
+	if _, err := CachedCepConcurrency(context.Background(), "20541155"); err != nil {
+		t.Fatalf("CachedCepConcurrency() returned an error: %v", err)
+	}
+	if _, ok, _ := s.Get("20541155"); !ok {
+		t.Errorf("CachedCepConcurrency() did not persist the address")
+	}
+
+	// o warm up de um cache vazio evita consultar os providers de novo
+	cepCache = cache.New[string, cepCacheEntry]("cep-test", 100)
+	if err := warmUpCepCache(); err != nil {
+		t.Fatalf("warmUpCepCache() returned an error: %v", err)
+	}
+	if _, err := CachedCepConcurrency(context.Background(), "20541155"); err != nil {
+		t.Fatalf("CachedCepConcurrency() returned an error: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("the provider was called %d times, expected 1", calls.Load())
+	}
+
+	if err := PurgeCep("20541-155"); err != nil {
+		t.Fatalf("PurgeCep() returned an error: %v", err)
+	}
+	if _, ok, _ := s.Get("20541155"); ok {
+		t.Errorf("PurgeCep() did not remove the address from the store")
+	}
+	if _, ok := cepCache.Get("20541155"); ok {
+		t.Errorf("PurgeCep() did not remove the address from the cache")
+	}
+}
+
+func TestAdminCepHandlerRequiresToken(t *testing.T) {
+	withEmptyCepCache(t)
+	s := withCepStore(t)
+	s.Put("20541155", external.Address{Cep: "20541155", City: "Rio de Janeiro"})
+	previous := adminToken
+	t.Cleanup(func() { adminToken = previous })
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{"no token configured", "", "", http.StatusServiceUnavailable},
+		{"no token configured, any header", "", "Bearer ", http.StatusServiceUnavailable},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		adminToken = tt.token
+		r := httptest.NewRequest(http.MethodDelete, "/admin/cep/20541155", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		recorder := httptest.NewRecorder()
+		adminCepHandler(recorder, r)
+		if recorder.Code != tt.status {
+			t.Errorf("%s: adminCepHandler() answered %d, expected %d", tt.name, recorder.Code, tt.status)
+		}
+		_, stored, _ := s.Get("20541155")
+		if stored != (tt.status != http.StatusNoContent) {
+			t.Errorf("%s: adminCepHandler() left the address stored: %v", tt.name, stored)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/configload"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/secret"
+)
+
+// Duration is a time.Duration read as "10s", "1m30s"... from YAML and env.
+type Duration = configload.Duration
+
+// Config is everything tempByCep reads at startup.
+// Values come from the defaults below, then CONFIG_FILE (YAML) and then env vars.
+type Config struct {
+	Port          int    `yaml:"port" env:"PORT"`
+	CollectorAddr string `yaml:"collector_addr" env:"OTEL_COLLECTOR_ADDR"`
+	AdminToken    string `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+	// TrustedProxies são os CIDRs (ou IPs) separados por vírgula cujo X-Forwarded-For é aceito
+	TrustedProxies string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	// WriteTimeout é o prazo para responder, a corrida de CEP e a consulta do tempo têm que caber nele
+	WriteTimeout Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+
+	Cep       CepConfig       `yaml:"cep"`
+	Weather   WeatherConfig   `yaml:"weather"`
+	Batch     BatchConfig     `yaml:"batch"`
+	Geocoding GeocodingConfig `yaml:"geocoding"`
+}
+
+type CepConfig struct {
+	// Providers segue o formato de CepRegistry.ApplySpec
+	Providers string `yaml:"providers" env:"CEP_PROVIDERS"`
+	// BrasilAPIVersion é v1 ou v2, só a v2 traz as coordenadas do CEP
+	BrasilAPIVersion string   `yaml:"brasilapi_version" env:"BRASILAPI_CEP_VERSION"`
+	RequestTimeout   Duration `yaml:"request_timeout" env:"CEP_REQUEST_TIMEOUT"`
+	RaceMode         string   `yaml:"race_mode" env:"CEP_RACE_MODE"`
+	RaceTimeout      Duration `yaml:"race_timeout" env:"CEP_RACE_TIMEOUT"`
+	MergeBudget      Duration `yaml:"merge_budget" env:"CEP_MERGE_BUDGET"`
+	CacheTTL         Duration `yaml:"cache_ttl" env:"CEP_CACHE_TTL"`
+	CacheNegativeTTL Duration `yaml:"cache_negative_ttl" env:"CEP_CACHE_NEGATIVE_TTL"`
+	CacheMaxEntries  int      `yaml:"cache_max_entries" env:"CEP_CACHE_MAX_ENTRIES"`
+	StorePath        string   `yaml:"store_path" env:"CEP_STORE_PATH"`
+}
+
+type WeatherConfig struct {
+	BaseURL string `yaml:"base_url" env:"WEATHER_API_BASE_URL"`
+	APIKey  string `yaml:"api_key" env:"WEATHER_API_KEY" secret:"true"`
+	// APIKeyFile é um secret montado (Docker/Kubernetes), relido quando muda
+	APIKeyFile     string   `yaml:"api_key_file" env:"WEATHER_API_KEY_FILE"`
+	RequestTimeout Duration `yaml:"request_timeout" env:"WEATHER_REQUEST_TIMEOUT"`
+}
+
+type BatchConfig struct {
+	// MaxSize é o máximo de CEPs em um POST /temp/batch
+	MaxSize     int `yaml:"max_size" env:"TEMP_BATCH_MAX_SIZE"`
+	Concurrency int `yaml:"concurrency" env:"TEMP_BATCH_CONCURRENCY"`
+	// Timeout substitui o WriteTimeout do servidor nas rotas de batch
+	Timeout Duration `yaml:"timeout" env:"TEMP_BATCH_TIMEOUT"`
+}
+
+type GeocodingConfig struct {
+	// Reverse é quem acha o CEP de GET /temp?lat=&lon=, "none" responde só a temperatura.
+	// Desligado por padrão pelo mesmo motivo do Forward
+	Reverse string `yaml:"reverse" env:"REVERSE_GEOCODER"`
+	// Forward acha as coordenadas dos CEPs que o provider não trouxe, "none" consulta o tempo pelo nome da cidade.
+	// Desligado por padrão: o Nominatim público aceita só uma request por segundo
+	Forward string `yaml:"forward" env:"FORWARD_GEOCODER"`
+	// ForwardBudget é o quanto a consulta do CEP espera pelas coordenadas, a fila do Nominatim incluída
+	ForwardBudget Duration `yaml:"forward_budget" env:"FORWARD_GEOCODER_BUDGET"`
+	NominatimURL  string   `yaml:"nominatim_url" env:"NOMINATIM_BASE_URL"`
+	// UserAgent é exigido pela política de uso do Nominatim
+	UserAgent string `yaml:"user_agent" env:"GEOCODING_USER_AGENT"`
+}
+
+func Default() Config {
+	return Config{
+		Port:          8090,
+		CollectorAddr: "otel-collector:4317",
+		WriteTimeout:  Duration(10 * time.Second),
+		// corrida + coordenadas + tempo cabem no WriteTimeout, assim o cliente recebe o 504 e não um reset
+		Cep: CepConfig{
+			BrasilAPIVersion: "v2",
+			RequestTimeout:   Duration(3 * time.Second),
+			RaceMode:         "first-success",
+			RaceTimeout:      Duration(4 * time.Second),
+			MergeBudget:      Duration(3 * time.Second),
+			CacheTTL:         Duration(24 * time.Hour),
+			CacheNegativeTTL: Duration(10 * time.Minute),
+			CacheMaxEntries:  10000,
+		},
+		Weather: WeatherConfig{
+			BaseURL:        "https://api.weatherapi.com/v1",
+			RequestTimeout: Duration(3 * time.Second),
+		},
+		Batch: BatchConfig{
+			MaxSize:     500,
+			Concurrency: 8,
+			Timeout:     Duration(60 * time.Second),
+		},
+		Geocoding: GeocodingConfig{
+			Reverse:       "none",
+			Forward:       "none",
+			ForwardBudget: Duration(2 * time.Second),
+			NominatimURL:  "https://nominatim.openstreetmap.org",
+			UserAgent:     "otel-cep/tempByCep",
+		},
+	}
+}
+
+// Load reads the config from CONFIG_FILE and the env vars and validates it.
+func Load() (Config, error) {
+	cfg := Default()
+	err := configload.Load(&cfg, os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return Config{}, err
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid value at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	if _, _, err := net.SplitHostPort(c.CollectorAddr); err != nil {
+		errs = append(errs, fmt.Errorf("OTEL_COLLECTOR_ADDR must be host:port, got %q", c.CollectorAddr))
+	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+	}
+
+	switch c.Cep.RaceMode {
+	case "first-response", "first-success", "merge":
+	default:
+		errs = append(errs, fmt.Errorf("CEP_RACE_MODE must be first-response, first-success or merge, got %q", c.Cep.RaceMode))
+	}
+	switch c.Cep.BrasilAPIVersion {
+	case "v1", "v2":
+	default:
+		errs = append(errs, fmt.Errorf("BRASILAPI_CEP_VERSION must be v1 or v2, got %q", c.Cep.BrasilAPIVersion))
+	}
+	positive := []struct {
+		name  string
+		value Duration
+	}{
+		{"HTTP_WRITE_TIMEOUT", c.WriteTimeout},
+		{"CEP_REQUEST_TIMEOUT", c.Cep.RequestTimeout},
+		{"CEP_RACE_TIMEOUT", c.Cep.RaceTimeout},
+		{"CEP_MERGE_BUDGET", c.Cep.MergeBudget},
+		{"CEP_CACHE_TTL", c.Cep.CacheTTL},
+		{"CEP_CACHE_NEGATIVE_TTL", c.Cep.CacheNegativeTTL},
+		{"WEATHER_REQUEST_TIMEOUT", c.Weather.RequestTimeout},
+		{"TEMP_BATCH_TIMEOUT", c.Batch.Timeout},
+		{"FORWARD_GEOCODER_BUDGET", c.Geocoding.ForwardBudget},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than zero, got %s", p.name, p.value))
+		}
+	}
+	if need := c.ResponseBudget(); need >= c.WriteTimeout {
+		errs = append(errs, fmt.Errorf("HTTP_WRITE_TIMEOUT must be longer than CEP_RACE_TIMEOUT + WEATHER_REQUEST_TIMEOUT"+
+			" (+ FORWARD_GEOCODER_BUDGET when FORWARD_GEOCODER is set) = %s, got %s", need, c.WriteTimeout))
+	}
+	if c.Cep.CacheMaxEntries < 0 {
+		errs = append(errs, fmt.Errorf("CEP_CACHE_MAX_ENTRIES must not be negative, got %d", c.Cep.CacheMaxEntries))
+	}
+
+	if c.Batch.MaxSize < 1 {
+		errs = append(errs, fmt.Errorf("TEMP_BATCH_MAX_SIZE must be greater than zero, got %d", c.Batch.MaxSize))
+	}
+	if c.Batch.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("TEMP_BATCH_CONCURRENCY must be greater than zero, got %d", c.Batch.Concurrency))
+	}
+
+	if u, err := url.Parse(c.Weather.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("WEATHER_API_BASE_URL must be an absolute url, got %q", c.Weather.BaseURL))
+	}
+	switch c.Geocoding.Reverse {
+	case "nominatim", "none":
+	default:
+		errs = append(errs, fmt.Errorf("REVERSE_GEOCODER must be nominatim or none, got %q", c.Geocoding.Reverse))
+	}
+	switch c.Geocoding.Forward {
+	case "nominatim", "none":
+	default:
+		errs = append(errs, fmt.Errorf("FORWARD_GEOCODER must be nominatim or none, got %q", c.Geocoding.Forward))
+	}
+	if u, err := url.Parse(c.Geocoding.NominatimURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("NOMINATIM_BASE_URL must be an absolute url, got %q", c.Geocoding.NominatimURL))
+	}
+	if c.Geocoding.UserAgent == "" {
+		errs = append(errs, errors.New("GEOCODING_USER_AGENT must not be empty"))
+	}
+	switch {
+	case c.Weather.APIKey == "" && c.Weather.APIKeyFile == "":
+		errs = append(errs, errors.New("WEATHER_API_KEY or WEATHER_API_KEY_FILE must be set"))
+	case c.Weather.APIKey != "" && c.Weather.APIKeyFile != "":
+		errs = append(errs, errors.New("only one of WEATHER_API_KEY and WEATHER_API_KEY_FILE can be set"))
+	case c.Weather.APIKeyFile != "":
+		if _, err := c.Weather.APIKeySource().Value(); err != nil {
+			errs = append(errs, fmt.Errorf("WEATHER_API_KEY_FILE: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// ResponseBudget is the longest a GET /temp/{cep} may wait on upstreams: the CEP race, the forward
+// geocoding when it is on and the weather request, one after the other.
+func (c Config) ResponseBudget() Duration {
+	budget := c.Cep.RaceTimeout + c.Weather.RequestTimeout
+	if c.Geocoding.Forward != "none" {
+		budget += c.Geocoding.ForwardBudget
+	}
+	return budget
+}
+
+// APIKeySource returns where the WeatherAPI key must be read from on each request.
+func (w WeatherConfig) APIKeySource() secret.Source {
+	if w.APIKeyFile != "" {
+		return secret.NewFile(w.APIKeyFile)
+	}
+	return secret.Static(w.APIKey)
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, a single address is taken as a prefix of its own.
+func (c Config) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, raw := range strings.Split(c.TrustedProxies, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !strings.Contains(raw, "/") {
+			addr, err := netip.ParseAddr(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an ip or a cidr", raw)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an ip or a cidr", raw)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// String prints the config with the secrets redacted, one env var per line.
+func (c Config) String() string {
+	return configload.Format(c)
+}
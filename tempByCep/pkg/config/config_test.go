@@ -0,0 +1,175 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "key")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	expected := Default()
+	expected.Weather.APIKey = "key"
+	if cfg != expected {
+		t.Errorf("Load() without file and env did not return the defaults: %+v", cfg)
+	}
+}
+
+func TestLoadRequiresWeatherAPIKey(t *testing.T) {
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "WEATHER_API_KEY") {
+		t.Errorf("Load() returned %v, expected a missing WEATHER_API_KEY error", err)
+	}
+
+	t.Setenv("WEATHER_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "WEATHER_API_KEY_FILE") {
+		t.Errorf("Load() returned %v, expected a missing WEATHER_API_KEY_FILE error", err)
+	}
+}
+
+func TestLoadWeatherAPIKeyFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "weather_api_key")
+	os.WriteFile(file, []byte("from-secret-file\n"), 0o600)
+	t.Setenv("WEATHER_API_KEY_FILE", file)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	key, err := cfg.Weather.APIKeySource().Value()
+	if err != nil || key != "from-secret-file" {
+		t.Errorf("APIKeySource().Value() = %q, %v", key, err)
+	}
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte(`
+port: 9000
+write_timeout: 15s
+cep:
+  race_mode: merge
+  race_timeout: 5s
+weather:
+  api_key: from-file
+`), 0o644)
+	t.Setenv("CONFIG_FILE", file)
+	// env vence o arquivo
+	t.Setenv("CEP_RACE_TIMEOUT", "7s")
+	t.Setenv("CEP_PROVIDERS", "ViaCEP:enabled=false")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if cfg.Port != 9000 || cfg.Cep.RaceMode != "merge" || cfg.Weather.APIKey != "from-file" {
+		t.Errorf("Load() did not read the file: %+v", cfg)
+	}
+	if time.Duration(cfg.Cep.RaceTimeout) != 7*time.Second {
+		t.Errorf("Load() did not let env override the file: %s", cfg.Cep.RaceTimeout)
+	}
+	if cfg.Cep.Providers != "ViaCEP:enabled=false" {
+		t.Errorf("Load() did not read CEP_PROVIDERS: %s", cfg.Cep.Providers)
+	}
+}
+
+func TestLoadReportsEveryInvalidValue(t *testing.T) {
+	t.Setenv("PORT", "0")
+	t.Setenv("CEP_RACE_MODE", "fastest")
+	t.Setenv("CEP_CACHE_TTL", "0s")
+	t.Setenv("WEATHER_API_BASE_URL", "api.weatherapi.com")
+	t.Setenv("TEMP_BATCH_CONCURRENCY", "0")
+	t.Setenv("REVERSE_GEOCODER", "google")
+	t.Setenv("FORWARD_GEOCODER", "google")
+	t.Setenv("BRASILAPI_CEP_VERSION", "v3")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.local")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatalf("Load() accepted an invalid config")
+	}
+	for _, name := range []string{"PORT", "CEP_RACE_MODE", "CEP_CACHE_TTL", "WEATHER_API_BASE_URL", "TEMP_BATCH_CONCURRENCY", "REVERSE_GEOCODER", "FORWARD_GEOCODER", "TRUSTED_PROXIES", "BRASILAPI_CEP_VERSION"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Load() error does not mention %s: %v", name, err)
+		}
+	}
+}
+
+func TestTrustedProxyPrefixes(t *testing.T) {
+	cfg := Default()
+	cfg.TrustedProxies = " 10.1.2.3/8, 192.168.0.10 ,::ffff:172.17.0.1,fd00::/8,"
+
+	prefixes, err := cfg.TrustedProxyPrefixes()
+	if err != nil {
+		t.Fatalf("TrustedProxyPrefixes() returned an error: %v", err)
+	}
+	expected := []string{"10.0.0.0/8", "192.168.0.10/32", "172.17.0.1/32", "fd00::/8"}
+	if len(prefixes) != len(expected) {
+		t.Fatalf("TrustedProxyPrefixes() returned %v, expected %v", prefixes, expected)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != expected[i] {
+			t.Errorf("TrustedProxyPrefixes() returned %v, expected %v", prefixes, expected)
+		}
+	}
+}
+
+func TestLoadRejectsMalformedEnv(t *testing.T) {
+	t.Setenv("CEP_RACE_TIMEOUT", "thirty seconds")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "CEP_RACE_TIMEOUT") {
+		t.Errorf("Load() returned %v, expected a CEP_RACE_TIMEOUT error", err)
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.AdminToken = "super-secret-token"
+	cfg.Weather.APIKey = "super-secret-key"
+
+	printed := cfg.String()
+	if strings.Contains(printed, cfg.Weather.APIKey) || strings.Contains(printed, cfg.AdminToken) {
+		t.Errorf("String() leaked a secret:\n%s", printed)
+	}
+	if !strings.Contains(printed, "PORT=8090") || !strings.Contains(printed, "CEP_RACE_TIMEOUT=4s") {
+		t.Errorf("String() did not print the config:\n%s", printed)
+	}
+}
+
+func TestValidateUpstreamsFitTheWriteTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *Config)
+		invalid bool
+	}{
+		{"defaults", func(cfg *Config) {}, false},
+		{"slow weather", func(cfg *Config) { cfg.Weather.RequestTimeout = Duration(60 * time.Second) }, true},
+		{"race as long as the write timeout", func(cfg *Config) { cfg.Cep.RaceTimeout = cfg.WriteTimeout }, true},
+		{"forward geocoding on", func(cfg *Config) {
+			cfg.Geocoding.Forward = "nominatim"
+			cfg.Cep.RaceTimeout = Duration(6 * time.Second)
+		}, true},
+		{"longer write timeout", func(cfg *Config) {
+			cfg.WriteTimeout = Duration(90 * time.Second)
+			cfg.Weather.RequestTimeout = Duration(60 * time.Second)
+		}, false},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.Weather.APIKey = "key"
+		tt.change(&cfg)
+		err := cfg.Validate()
+		if tt.invalid != (err != nil && strings.Contains(err.Error(), "HTTP_WRITE_TIMEOUT")) {
+			t.Errorf("%s: Validate() returned %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/geo"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// reverseGeocoder acha o CEP mais próximo das coordenadas, nil responde só a temperatura
+var reverseGeocoder external.ReverseGeocoder
+
+// forwardGeocoder acha as coordenadas dos endereços que o provider de CEP não trouxe, nil desliga
+var forwardGeocoder external.ForwardGeocoder
+
+// forwardGeocodeBudget é o quanto a consulta do CEP espera pelas coordenadas, a fila do Nominatim incluída
+var forwardGeocodeBudget = 2 * time.Second
+
+// CoordinatesTempResponse is the TempResponse of a coordinate with the closest address found,
+// Cep and Address are left out when no reverse geocoder is configured or it could not answer.
+type CoordinatesTempResponse struct {
+	TempResponse
+	Lat     float64           `json:"lat"`
+	Lon     float64           `json:"lon"`
+	Cep     string            `json:"cep,omitempty"`
+	Address *external.Address `json:"address,omitempty"`
+}
+
+// tempByCoordinatesHandler devolve a temperatura e o CEP mais próximo de uma coordenada: GET /temp?lat=..&lon=..
+func tempByCoordinatesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("temp").Start(ctx, "tempByCoordinatesHandler")
+	defer span.End()
+
+	point, err := readCoordinates(r.URL.Query())
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Float64("lat", point.Lat), attribute.Float64("lon", point.Lon))
+
+	temp, err := resolveTempByCoordinates(ctx, point)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(temp)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// readCoordinates lê e valida lat e lon, os dois obrigatórios.
+func readCoordinates(query url.Values) (geo.Point, error) {
+	if !query.Has("lat") || !query.Has("lon") {
+		return geo.Point{}, apperr.New(apperr.InvalidInput, "lat and lon are required")
+	}
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return geo.Point{}, apperr.New(apperr.InvalidInput, fmt.Sprintf("lat must be a number between -90 and 90, got %q", query.Get("lat")))
+	}
+	lon, err := strconv.ParseFloat(query.Get("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return geo.Point{}, apperr.New(apperr.InvalidInput, fmt.Sprintf("lon must be a number between -180 and 180, got %q", query.Get("lon")))
+	}
+	return geo.Point{Lat: lat, Lon: lon}, nil
+}
+
+// resolveTempByCoordinates consulta a WeatherAPI pela coordenada e, ao mesmo tempo, o endereço mais próximo.
+func resolveTempByCoordinates(ctx context.Context, point geo.Point) (CoordinatesTempResponse, error) {
+	type reverseResult struct {
+		address external.Address
+		err     error
+	}
+	// se a WeatherAPI falhar a busca do endereço é cancelada junto
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	geocoder := reverseGeocoder
+	reversed := make(chan reverseResult, 1)
+	if geocoder != nil {
+		go func() {
+			address, err := reverseGeocode(ctx, geocoder, point)
+			reversed <- reverseResult{address, err}
+		}()
+	}
+
+	// a WeatherAPI aceita "lat,lon" no q
+	temp, err := CachedCurrentWeather(ctx, coordinatesQuery(point), "pt")
+	if err != nil {
+		return CoordinatesTempResponse{}, err
+	}
+	response := CoordinatesTempResponse{TempResponse: newTempResponse(temp), Lat: point.Lat, Lon: point.Lon}
+	if geocoder == nil {
+		return response, nil
+	}
+
+	// o CEP é um extra, sem ele a temperatura continua valendo
+	result := <-reversed
+	if result.err != nil {
+		log.Printf("reverse geocoding %s: %v", coordinatesQuery(point), result.err)
+		trace.SpanFromContext(ctx).RecordError(result.err)
+		return response, nil
+	}
+	response.Cep = result.address.Cep
+	response.Address = &result.address
+	return response, nil
+}
+
+func reverseGeocode(ctx context.Context, geocoder external.ReverseGeocoder, point geo.Point) (external.Address, error) {
+	ctx, span := otel.Tracer("temp").Start(ctx, "reverse-geocode")
+	defer span.End()
+	span.SetAttributes(attribute.String("geocoder", geocoder.Name()))
+
+	address, err := geocoder.Reverse(ctx, point.Lat, point.Lon)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, apperr.Message(err))
+		return external.Address{}, err
+	}
+	span.SetAttributes(attribute.String("cep", address.Cep))
+	return address, nil
+}
+
+// locateAddress completa as coordenadas do endereço com o forwardGeocoder. Sem coordenadas o tempo
+// ainda pode ser consultado pelo nome da cidade, então uma falha aqui não falha a consulta do CEP.
+func locateAddress(ctx context.Context, address external.Address) external.Address {
+	geocoder := forwardGeocoder
+	if address.Coordinates != nil || geocoder == nil {
+		return address
+	}
+	ctx, span := otel.Tracer("cep").Start(ctx, "forward-geocode")
+	defer span.End()
+	span.SetAttributes(attribute.String("geocoder", geocoder.Name()))
+	ctx, cancel := context.WithTimeout(ctx, forwardGeocodeBudget)
+	defer cancel()
+
+	coordinates, err := geocoder.Forward(ctx, address)
+	if err != nil {
+		log.Printf("locating %s, %s: %v", address.City, address.State, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, apperr.Message(err))
+		return address
+	}
+	address.Coordinates = &coordinates
+	return address
+}
+
+// weatherQuery é como a WeatherAPI encontra a cidade do endereço: pelas coordenadas quando o endereço tem,
+// senão por cidade-estado-brazil, que em municípios pequenos às vezes cai em outro lugar
+func weatherQuery(ctx context.Context, address external.Address) string {
+	span := trace.SpanFromContext(ctx)
+	if address.Coordinates != nil {
+		span.SetAttributes(
+			attribute.String("weather.query.strategy", "coordinates"),
+			attribute.String("weather.query.coordinates_source", address.Coordinates.Source),
+		)
+		return coordinatesQuery(geo.Point{Lat: address.Coordinates.Lat, Lon: address.Coordinates.Lon})
+	}
+	span.SetAttributes(attribute.String("weather.query.strategy", "name"))
+	return strings.Join([]string{utils.RemoveAccents(address.City), utils.RemoveAccents(address.State), "brazil"}, "-")
+}
+
+// coordinatesQuery arredonda para ~10m, o suficiente para o tempo e para o cache
+func coordinatesQuery(point geo.Point) string {
+	return strconv.FormatFloat(point.Lat, 'f', 4, 64) + "," + strconv.FormatFloat(point.Lon, 'f', 4, 64)
+}
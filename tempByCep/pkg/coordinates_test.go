@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+// withReverseGeocoder troca o geocoder durante o teste, nil desliga.
+func withReverseGeocoder(t *testing.T, geocoder external.ReverseGeocoder) {
+	t.Helper()
+	previous := reverseGeocoder
+	reverseGeocoder = geocoder
+	t.Cleanup(func() { reverseGeocoder = previous })
+}
+
+// withForwardGeocoder troca o geocoder dos endereços durante o teste, nil desliga.
+func withForwardGeocoder(t *testing.T, geocoder external.ForwardGeocoder) {
+	t.Helper()
+	previous := forwardGeocoder
+	forwardGeocoder = geocoder
+	t.Cleanup(func() { forwardGeocoder = previous })
+}
+
+func getTempByCoordinates(target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	tempByCoordinatesHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func TestTempByCoordinatesHandler(t *testing.T) {
+	var query string
+	withFakeWeather(t, func(ctx context.Context, q string, lang string) (external.CurrentModel, error) {
+		query = q
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+	withReverseGeocoder(t, external.NewReverseGeocoder("fake", func(ctx context.Context, lat float64, lon float64) (external.Address, error) {
+		return external.Address{Cep: "20541155", City: "Rio de Janeiro", State: "RJ", Source: "fake"}, nil
+	}))
+
+	recorder := getTempByCoordinates("/temp?lat=-22.916312&lon=-43.2437")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("tempByCoordinatesHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if query != "-22.9163,-43.2437" {
+		t.Errorf("tempByCoordinatesHandler() asked WeatherAPI for %q", query)
+	}
+	var response CoordinatesTempResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("tempByCoordinatesHandler() answered an invalid body: %v", err)
+	}
+	if response.Temp_C != 25 || response.Temp_K != 298 || response.Cep != "20541155" || response.Address == nil || response.Address.State != "RJ" {
+		t.Errorf("tempByCoordinatesHandler() answered %+v", response)
+	}
+}
+
+func TestTempByCoordinatesHandlerWithoutGeocoder(t *testing.T) {
+	withFakeWeather(t, func(ctx context.Context, q string, lang string) (external.CurrentModel, error) {
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+	withReverseGeocoder(t, nil)
+
+	recorder := getTempByCoordinates("/temp?lat=-22.9&lon=-43.2")
+	var response CoordinatesTempResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusOK || response.Temp_C != 25 || response.Cep != "" || response.Address != nil {
+		t.Errorf("tempByCoordinatesHandler() answered %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestTempByCoordinatesHandlerGeocoderFailure(t *testing.T) {
+	withFakeWeather(t, func(ctx context.Context, q string, lang string) (external.CurrentModel, error) {
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+	for _, err := range []error{
+		apperr.New(apperr.RateLimited, "nominatim is rate limiting us"),
+		apperr.New(apperr.InvalidInput, "outside Brazil"),
+	} {
+		withReverseGeocoder(t, external.NewReverseGeocoder("fake", func(ctx context.Context, lat float64, lon float64) (external.Address, error) {
+			return external.Address{}, err
+		}))
+
+		recorder := getTempByCoordinates("/temp?lat=-34.9&lon=-56.2")
+		var response CoordinatesTempResponse
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		if recorder.Code != http.StatusOK || response.Temp_C != 25 || response.Cep != "" || response.Address != nil {
+			t.Errorf("tempByCoordinatesHandler() answered %d %s when the geocoder failed with %v", recorder.Code, recorder.Body, err)
+		}
+	}
+}
+
+func TestTempByCoordinatesHandlerErrors(t *testing.T) {
+	withFakeWeather(t, func(ctx context.Context, q string, lang string) (external.CurrentModel, error) {
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+	withReverseGeocoder(t, nil)
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/temp?lat=-22.9", http.StatusUnprocessableEntity},
+		{"/temp?lat=-95&lon=-43.2", http.StatusUnprocessableEntity},
+		{"/temp?lat=-22.9&lon=west", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		recorder := getTempByCoordinates(tt.target)
+		if recorder.Code != tt.status {
+			t.Errorf("tempByCoordinatesHandler() answered %d for %s, expected %d", recorder.Code, tt.target, tt.status)
+		}
+	}
+}
+
+func TestCachedCepConcurrencyLocatesAddress(t *testing.T) {
+	withEmptyCepCache(t)
+	withCepProviders(t,
+		fakeCepProvider{name: "a", address: external.Address{Cep: "25900028", City: "Magé", State: "RJ"}},
+	)
+	var located []string
+	withForwardGeocoder(t, external.NewForwardGeocoder("fake", func(ctx context.Context, address external.Address) (external.Coordinates, error) {
+		located = append(located, address.City)
+		return external.Coordinates{Lat: -22.6528, Lon: -43.0406, Source: "fake"}, nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		address, err := CachedCepConcurrency(context.Background(), "25900028")
+		if err != nil || address.Coordinates == nil || address.Coordinates.Lat != -22.6528 {
+			t.Fatalf("CachedCepConcurrency() returned %+v, %v", address, err)
+		}
+	}
+	// as coordenadas ficam no cache junto do endereço
+	if len(located) != 1 || located[0] != "Magé" {
+		t.Errorf("CachedCepConcurrency() geocoded %v, expected Magé once", located)
+	}
+}
+
+func TestCachedCepConcurrencyKeepsProviderCoordinates(t *testing.T) {
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{
+		Cep: "25900028", City: "Magé", State: "RJ", Coordinates: &external.Coordinates{Lat: -22.65, Lon: -43.04, Source: "a"},
+	}})
+	withForwardGeocoder(t, external.NewForwardGeocoder("fake", func(ctx context.Context, address external.Address) (external.Coordinates, error) {
+		t.Errorf("CachedCepConcurrency() geocoded an address that already had coordinates")
+		return external.Coordinates{}, nil
+	}))
+
+	address, err := CachedCepConcurrency(context.Background(), "25900028")
+	if err != nil || address.Coordinates == nil || address.Coordinates.Source != "a" {
+		t.Errorf("CachedCepConcurrency() returned %+v, %v", address, err)
+	}
+}
+
+func TestCachedCepConcurrencyIgnoresGeocoderFailure(t *testing.T) {
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "25900028", City: "Magé", State: "RJ"}})
+	withForwardGeocoder(t, external.NewForwardGeocoder("fake", func(ctx context.Context, address external.Address) (external.Coordinates, error) {
+		return external.Coordinates{}, apperr.New(apperr.RateLimited, "nominatim is rate limiting us")
+	}))
+
+	address, err := CachedCepConcurrency(context.Background(), "25900028")
+	if err != nil || address.City != "Magé" || address.Coordinates != nil {
+		t.Errorf("CachedCepConcurrency() returned %+v, %v", address, err)
+	}
+}
+
+func TestCachedCepConcurrencyGeocoderBudget(t *testing.T) {
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "25900028", City: "Magé", State: "RJ"}})
+	withForwardGeocoder(t, external.NewForwardGeocoder("slow", func(ctx context.Context, address external.Address) (external.Coordinates, error) {
+		<-ctx.Done()
+		return external.Coordinates{}, ctx.Err()
+	}))
+	previous := forwardGeocodeBudget
+	forwardGeocodeBudget = 20 * time.Millisecond
+	t.Cleanup(func() { forwardGeocodeBudget = previous })
+
+	start := time.Now()
+	address, err := CachedCepConcurrency(context.Background(), "25900028")
+	if err != nil || address.City != "Magé" || address.Coordinates != nil {
+		t.Errorf("CachedCepConcurrency() returned %+v, %v", address, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CachedCepConcurrency() waited %v for the geocoder", elapsed)
+	}
+}
+
+func TestResolveTempQueriesByCoordinates(t *testing.T) {
+	tests := []struct {
+		name        string
+		coordinates *external.Coordinates
+		query       string
+	}{
+		{"coordinates", &external.Coordinates{Lat: -22.65281, Lon: -43.04059, Source: "fake"}, "-22.6528,-43.0406"},
+		{"name", nil, "Mage-RJ-brazil"},
+	}
+	for _, tt := range tests {
+		withEmptyCepCache(t)
+		withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "25900028", City: "Magé", State: "RJ", Coordinates: tt.coordinates}})
+		var query string
+		withFakeWeather(t, func(ctx context.Context, q string, lang string) (external.CurrentModel, error) {
+			query = q
+			return weatherUpdatedAt(time.Now(), 25), nil
+		})
+
+		_, err := resolveTemp(context.Background(), "25900028")
+		if err != nil || query != tt.query {
+			t.Errorf("%s: resolveTemp() asked WeatherAPI for %q (%v), expected %q", tt.name, query, err, tt.query)
+		}
+	}
+}
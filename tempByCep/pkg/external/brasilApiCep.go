@@ -3,17 +3,18 @@ package external
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
 )
 
-const requestExpirationTime = 10 * time.Second
+var requestExpirationTime = 3 * time.Second
 
 type Address struct {
 	Cep          string `json:"cep"`
@@ -22,6 +23,22 @@ type Address struct {
 	Neighborhood string `json:"neighborhood"`
 	Street       string `json:"street"`
 	Source       string `json:"source"`
+	// Coordinates is nil when neither the provider nor the geocoder could place the address.
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+	// Sources explains where each field came from when several providers were merged.
+	Sources []FieldSource `json:"sources,omitempty"`
+}
+
+// Coordinates of an address, Source is the provider or geocoder that placed it.
+type Coordinates struct {
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Source string  `json:"source"`
+}
+
+// IsEmpty reports whether no address field was filled.
+func (a Address) IsEmpty() bool {
+	return a.Cep == "" && a.State == "" && a.City == "" && a.Neighborhood == "" && a.Street == ""
 }
 
 type errorResponse struct {
@@ -30,9 +47,57 @@ type errorResponse struct {
 	Message string `json:"message"`
 }
 
+var brasilApiUrl = "https://brasilapi.com.br/api/cep"
+
+// brasilApiCepVersion escolhe qual BrasilAPI entra no DefaultCepRegistry, só a v2 traz coordenadas
+var brasilApiCepVersion = "v2"
+
+// brasilApiResponse é o Address da v1, a v2 acrescenta o location
+type brasilApiResponse struct {
+	Address
+	Location *struct {
+		Coordinates struct {
+			// vêm como string, e vazias quando a BrasilAPI não conhece o lugar
+			Latitude  json.RawMessage `json:"latitude"`
+			Longitude json.RawMessage `json:"longitude"`
+		} `json:"coordinates"`
+	} `json:"location"`
+}
+
+// coordinates returns nil when the answer has no location or an incomplete one.
+func (r brasilApiResponse) coordinates() *Coordinates {
+	if r.Location == nil {
+		return nil
+	}
+	lat, err := parseCoordinate(r.Location.Coordinates.Latitude)
+	if err != nil {
+		return nil
+	}
+	lon, err := parseCoordinate(r.Location.Coordinates.Longitude)
+	if err != nil {
+		return nil
+	}
+	return &Coordinates{Lat: lat, Lon: lon, Source: "brasilAPI"}
+}
+
+func parseCoordinate(raw json.RawMessage) (float64, error) {
+	return strconv.ParseFloat(strings.Trim(string(raw), `"`), 64)
+}
+
+// BrasilApiCep looks cep up on BrasilAPI v1, which answers without coordinates.
 func BrasilApiCep(ctx context.Context, cep string) (Address, error) {
+	return brasilApiCep(ctx, cep, "v1")
+}
+
+// BrasilApiCepV2 looks cep up on BrasilAPI v2, which also answers the coordinates when it knows them.
+func BrasilApiCepV2(ctx context.Context, cep string) (Address, error) {
+	return brasilApiCep(ctx, cep, "v2")
+}
+
+func brasilApiCep(ctx context.Context, cep string, version string) (Address, error) {
 	ctx, externalSpan := otel.GetTracerProvider().Tracer("cep").Start(ctx, "brasilCep-cep-external")
 	defer externalSpan.End()
+	externalSpan.SetAttributes(attribute.String("brasilapi.version", version))
 	err := utils.ValidateCep(cep)
 	if err != nil {
 		return Address{}, utils.InvalidZipError
@@ -41,7 +106,7 @@ func BrasilApiCep(ctx context.Context, cep string) (Address, error) {
 	// o contexto expira em 1 segundo!
 	ctx, cancel := context.WithTimeout(ctx, requestExpirationTime)
 	defer cancel() // de alguma forma nosso contexto será cancelado
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://brasilapi.com.br/api/cep/v1/"+cep, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", brasilApiUrl+"/"+version+"/"+cep, nil)
 
 	if err != nil {
 		return Address{}, err
@@ -51,8 +116,9 @@ func BrasilApiCep(ctx context.Context, cep string) (Address, error) {
 	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
-		return Address{}, err
+		return Address{}, lookupError(ctx, "brasilAPI", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 
@@ -60,29 +126,25 @@ func BrasilApiCep(ctx context.Context, cep string) (Address, error) {
 			return Address{}, utils.ZipNotFoundError
 		}
 
-		return Address{}, errors.New("unkown error")
-
-	}
+		return Address{}, statusError("brasilAPI", resp.StatusCode)
 
-	if ctx.Err() == context.DeadlineExceeded {
-		fmt.Println("Api fetch timeout exceeed.")
-		return Address{}, errors.New("api fetch timeout exceeed")
 	}
 
 	// depois de tudo termina e faz o body
-	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return Address{}, err
+		return Address{}, lookupError(ctx, "brasilAPI", err)
 	}
-	var addressData Address
-	err = json.Unmarshal(body, &addressData)
+	var response brasilApiResponse
+	err = json.Unmarshal(body, &response)
 	if err != nil {
 		return Address{}, err
 	}
+	addressData := response.Address
+	addressData.Coordinates = response.coordinates()
 
 	//empty struct = valid format but no data
-	if (addressData == Address{}) {
+	if addressData.IsEmpty() {
 		return Address{}, utils.ZipNotFoundError
 	}
 
@@ -2,14 +2,30 @@ package external
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
 )
 
+// requireLiveCepProviders pula os testes que consultam a BrasilAPI e o ViaCEP de verdade, que só rodam
+// com LIVE_TESTS definido. O comportamento dos clients é coberto offline pelos servidores de teste.
+func requireLiveCepProviders(t *testing.T) {
+	t.Helper()
+	if os.Getenv("LIVE_TESTS") == "" {
+		t.Skip("LIVE_TESTS is not set, skipping the test against the real CEP providers")
+	}
+}
+
 func TestViaCep(t *testing.T) {
+	requireLiveCepProviders(t)
+
 	cep := "20541155"
 	result, err := ViaCep(context.Background(), cep)
 	if err != nil {
@@ -34,6 +50,8 @@ func TestViaCep(t *testing.T) {
 }
 
 func TestViaCepZipNotFound(t *testing.T) {
+	requireLiveCepProviders(t)
+
 	cep := "90541155"
 	_, err := ViaCep(context.Background(), cep)
 	if err == nil {
@@ -57,6 +75,8 @@ func TestViaCepInvalidFormat(t *testing.T) {
 }
 
 func TestBrasilApiCep(t *testing.T) {
+	requireLiveCepProviders(t)
+
 	cep := "20541155"
 	result, err := BrasilApiCep(context.Background(), cep)
 	if err != nil {
@@ -81,6 +101,8 @@ func TestBrasilApiCep(t *testing.T) {
 }
 
 func TestBrasilApiCepZipNotFound(t *testing.T) {
+	requireLiveCepProviders(t)
+
 	cep := "90541155"
 	_, err := BrasilApiCep(context.Background(), cep)
 	if err == nil {
@@ -102,3 +124,132 @@ func TestBrasilApiCepInvalidFormat(t *testing.T) {
 		t.Errorf("BrasilApi() did not return an " + utils.InvalidZipError.Error() + " zipcode error")
 	}
 }
+
+// withFakeBrasilApi aponta o client da BrasilAPI para um servidor de teste.
+func withFakeBrasilApi(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := brasilApiUrl
+	brasilApiUrl = server.URL
+	t.Cleanup(func() {
+		server.Close()
+		brasilApiUrl = previous
+	})
+}
+
+func TestBrasilApiCepV2Coordinates(t *testing.T) {
+	answers := map[string]string{
+		"/v2/20541155": `{"cep":"20541155","state":"RJ","city":"Rio de Janeiro","neighborhood":"Vila Isabel","street":"Rua Pereira Nunes",
+			"location":{"type":"Point","coordinates":{"longitude":"-43.2437","latitude":"-22.9163"}}}`,
+		"/v2/25900028": `{"cep":"25900028","state":"RJ","city":"Magé","location":{"type":"Point","coordinates":{}}}`,
+		"/v1/20541155": `{"cep":"20541155","state":"RJ","city":"Rio de Janeiro","neighborhood":"Vila Isabel","street":"Rua Pereira Nunes"}`,
+	}
+	withFakeBrasilApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(answers[r.URL.Path]))
+	})
+
+	address, err := BrasilApiCepV2(context.Background(), "20541155")
+	if err != nil {
+		t.Fatalf("BrasilApiCepV2() returned an error: %v", err)
+	}
+	if address.City != "Rio de Janeiro" || address.Source != "brasilAPI" ||
+		address.Coordinates == nil || *address.Coordinates != (Coordinates{Lat: -22.9163, Lon: -43.2437, Source: "brasilAPI"}) {
+		t.Errorf("BrasilApiCepV2() returned %+v with coordinates %+v", address, address.Coordinates)
+	}
+
+	// a BrasilAPI nem sempre sabe onde fica o CEP
+	address, err = BrasilApiCepV2(context.Background(), "25900028")
+	if err != nil || address.City != "Magé" || address.Coordinates != nil {
+		t.Errorf("BrasilApiCepV2() returned %+v, %v for a CEP without coordinates", address, err)
+	}
+
+	address, err = BrasilApiCep(context.Background(), "20541155")
+	if err != nil || address.Street != "Rua Pereira Nunes" || address.Coordinates != nil {
+		t.Errorf("BrasilApiCep() returned %+v, %v", address, err)
+	}
+}
+
+func TestDefaultCepRegistryBrasilApiVersion(t *testing.T) {
+	var requested []string
+	withFakeBrasilApi(t, func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Write([]byte(`{"cep":"20541155","city":"Rio de Janeiro"}`))
+	})
+	previous := brasilApiCepVersion
+	t.Cleanup(func() { brasilApiCepVersion = previous })
+
+	for _, version := range []string{"v1", "v2"} {
+		brasilApiCepVersion = version
+		for _, provider := range DefaultCepRegistry().Providers() {
+			if provider.Name() == "brasilAPI" {
+				provider.Lookup(context.Background(), "20541155")
+			}
+		}
+	}
+	if !reflect.DeepEqual(requested, []string{"/v1/20541155", "/v2/20541155"}) {
+		t.Errorf("DefaultCepRegistry() asked BrasilAPI for %v", requested)
+	}
+}
+
+// withFakeViaCep aponta o client do ViaCEP para um servidor de teste.
+func withFakeViaCep(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := viaCepUrl
+	viaCepUrl = server.URL
+	t.Cleanup(func() {
+		server.Close()
+		viaCepUrl = previous
+	})
+}
+
+func TestViaCepAnswers(t *testing.T) {
+	withFakeViaCep(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/20541155/json/":
+			w.Write([]byte(`{"cep":"20541-155","logradouro":"Rua Pereira Nunes","bairro":"Vila Isabel","localidade":"Rio de Janeiro","uf":"RJ"}`))
+		case "/90541155/json/":
+			// o ViaCEP responde 200 com erro para CEP inexistente
+			w.Write([]byte(`{"erro": true}`))
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+
+	address, err := ViaCep(context.Background(), "20541155")
+	expected := Address{Cep: "20541-155", State: "RJ", City: "Rio de Janeiro", Neighborhood: "Vila Isabel", Street: "Rua Pereira Nunes", Source: "ViaCEP"}
+	if err != nil || !reflect.DeepEqual(address, expected) {
+		t.Errorf("ViaCep() returned %+v, %v, expected %+v", address, err, expected)
+	}
+
+	_, err = ViaCep(context.Background(), "90541155")
+	if err != utils.ZipNotFoundError {
+		t.Errorf("ViaCep() returned %v, expected %v", err, utils.ZipNotFoundError)
+	}
+
+	_, err = ViaCep(context.Background(), "25900028")
+	if !errors.Is(err, apperr.RateLimited) {
+		t.Errorf("ViaCep() returned %v, expected %v", err, apperr.RateLimited)
+	}
+}
+
+func TestBrasilApiCepErrorAnswers(t *testing.T) {
+	withFakeBrasilApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/90541155") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"name":"CepPromiseError","message":"Todos os serviços de CEP retornaram erro.","type":"service_error"}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := BrasilApiCep(context.Background(), "90541155")
+	if err != utils.ZipNotFoundError {
+		t.Errorf("BrasilApiCep() returned %v, expected %v", err, utils.ZipNotFoundError)
+	}
+
+	_, err = BrasilApiCepV2(context.Background(), "20541155")
+	if !errors.Is(err, apperr.UpstreamUnavailable) {
+		t.Errorf("BrasilApiCepV2() returned %v, expected %v", err, apperr.UpstreamUnavailable)
+	}
+}
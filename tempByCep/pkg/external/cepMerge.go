@@ -0,0 +1,87 @@
+package external
+
+import (
+	"strings"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
+)
+
+// FieldSource records which provider supplied a merged field
+// and what the other providers answered when they disagreed.
+type FieldSource struct {
+	Field         string              `json:"field"`
+	Provider      string              `json:"provider"`
+	Value         string              `json:"value"`
+	Disagreements []FieldDisagreement `json:"disagreements,omitempty"`
+}
+
+type FieldDisagreement struct {
+	Provider string `json:"provider"`
+	Value    string `json:"value"`
+}
+
+// addressFields lists the merged fields and how to read each one from an Address.
+var addressFields = []struct {
+	name string
+	get  func(*Address) *string
+}{
+	{"cep", func(a *Address) *string { return &a.Cep }},
+	{"state", func(a *Address) *string { return &a.State }},
+	{"city", func(a *Address) *string { return &a.City }},
+	{"neighborhood", func(a *Address) *string { return &a.Neighborhood }},
+	{"street", func(a *Address) *string { return &a.Street }},
+}
+
+func normalizeField(field string, value string) string {
+	if field == "cep" {
+		return strings.ReplaceAll(strings.TrimSpace(value), "-", "")
+	}
+	return utils.NormalizeAddress(value)
+}
+
+// MergeAddresses reconciles the answers of several providers, ordered by priority.
+// Each field takes the first non empty value, the lower priority answers only fill gaps.
+// Values that differ after normalization (accents, "R." vs "Rua") are reported as disagreements.
+func MergeAddresses(addresses []Address) Address {
+	var merged Address
+	var providers []string
+	for _, address := range addresses {
+		providers = append(providers, address.Source)
+	}
+	merged.Source = strings.Join(providers, ",")
+
+	for _, field := range addressFields {
+		var source *FieldSource
+		for i := range addresses {
+			value := strings.TrimSpace(*field.get(&addresses[i]))
+			if value == "" {
+				continue
+			}
+			if source == nil {
+				source = &FieldSource{Field: field.name, Provider: addresses[i].Source, Value: value}
+				continue
+			}
+			if normalizeField(field.name, value) != normalizeField(field.name, source.Value) {
+				source.Disagreements = append(source.Disagreements, FieldDisagreement{
+					Provider: addresses[i].Source,
+					Value:    value,
+				})
+			}
+		}
+		if source == nil {
+			continue
+		}
+		*field.get(&merged) = source.Value
+		merged.Sources = append(merged.Sources, *source)
+	}
+
+	// coordenadas não se misturam, vale a do provider de maior prioridade que tiver
+	for _, address := range addresses {
+		if address.Coordinates != nil {
+			merged.Coordinates = address.Coordinates
+			break
+		}
+	}
+
+	return merged
+}
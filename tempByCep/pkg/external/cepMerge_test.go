@@ -0,0 +1,70 @@
+package external
+
+import (
+	"testing"
+)
+
+func TestMergeAddressesFillsGaps(t *testing.T) {
+	brasilApi := Address{Cep: "20541155", State: "RJ", City: "Rio de Janeiro", Street: "Rua Barão de Mesquita", Source: "brasilAPI"}
+	viaCep := Address{Cep: "20541-155", State: "RJ", City: "Rio de Janeiro", Neighborhood: "Andaraí", Street: "R. Barao de Mesquita", Source: "ViaCEP"}
+
+	merged := MergeAddresses([]Address{brasilApi, viaCep})
+
+	if merged.Street != "Rua Barão de Mesquita" {
+		t.Errorf("MergeAddresses() did not keep the street of the first provider: %s", merged.Street)
+	}
+	if merged.Neighborhood != "Andaraí" {
+		t.Errorf("MergeAddresses() did not fill the neighborhood gap: %s", merged.Neighborhood)
+	}
+	if merged.Source != "brasilAPI,ViaCEP" {
+		t.Errorf("MergeAddresses() returned source %s", merged.Source)
+	}
+
+	expected := map[string]string{
+		"cep": "brasilAPI", "state": "brasilAPI", "city": "brasilAPI", "neighborhood": "ViaCEP", "street": "brasilAPI",
+	}
+	if len(merged.Sources) != len(expected) {
+		t.Fatalf("MergeAddresses() returned %d sources, expected %d", len(merged.Sources), len(expected))
+	}
+	for _, source := range merged.Sources {
+		if source.Provider != expected[source.Field] {
+			t.Errorf("MergeAddresses() field %s came from %s, expected %s", source.Field, source.Provider, expected[source.Field])
+		}
+		// "R." x "Rua" e acentos não são divergências
+		if len(source.Disagreements) != 0 {
+			t.Errorf("MergeAddresses() reported a disagreement on %s: %v", source.Field, source.Disagreements)
+		}
+	}
+}
+
+func TestMergeAddressesReportsDisagreements(t *testing.T) {
+	merged := MergeAddresses([]Address{
+		{Cep: "25900028", City: "Magé", Street: "Rua A", Source: "brasilAPI"},
+		{Cep: "25900028", City: "Mage", Street: "Avenida B", Source: "ViaCEP"},
+	})
+
+	for _, source := range merged.Sources {
+		switch source.Field {
+		case "street":
+			if len(source.Disagreements) != 1 || source.Disagreements[0] != (FieldDisagreement{Provider: "ViaCEP", Value: "Avenida B"}) {
+				t.Errorf("MergeAddresses() did not report the street disagreement: %v", source.Disagreements)
+			}
+		default:
+			if len(source.Disagreements) != 0 {
+				t.Errorf("MergeAddresses() reported a disagreement on %s: %v", source.Field, source.Disagreements)
+			}
+		}
+	}
+}
+
+func TestMergeAddressesKeepsFirstCoordinates(t *testing.T) {
+	merged := MergeAddresses([]Address{
+		{Cep: "25900028", City: "Magé", Source: "ViaCEP"},
+		{Cep: "25900028", City: "Magé", Source: "brasilAPI", Coordinates: &Coordinates{Lat: -22.65, Lon: -43.04, Source: "brasilAPI"}},
+		{Cep: "25900028", City: "Magé", Source: "other", Coordinates: &Coordinates{Lat: -22.6, Lon: -43.1, Source: "other"}},
+	})
+
+	if merged.Coordinates == nil || merged.Coordinates.Source != "brasilAPI" {
+		t.Errorf("MergeAddresses() returned coordinates %+v, expected the ones of brasilAPI", merged.Coordinates)
+	}
+}
@@ -0,0 +1,214 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+)
+
+// CepProvider é qualquer fonte capaz de transformar um CEP em um Address.
+type CepProvider interface {
+	Name() string
+	Lookup(ctx context.Context, cep string) (Address, error)
+}
+
+type cepProviderFunc struct {
+	name   string
+	lookup func(ctx context.Context, cep string) (Address, error)
+}
+
+func (p cepProviderFunc) Name() string {
+	return p.name
+}
+
+func (p cepProviderFunc) Lookup(ctx context.Context, cep string) (Address, error) {
+	return p.lookup(ctx, cep)
+}
+
+// NewCepProvider adapts a plain lookup function (like ViaCep) into a CepProvider.
+func NewCepProvider(name string, lookup func(ctx context.Context, cep string) (Address, error)) CepProvider {
+	return cepProviderFunc{name: name, lookup: lookup}
+}
+
+// lookupError classifies a failed provider request, ctx is the context of that request.
+func lookupError(ctx context.Context, provider string, err error) error {
+	if ctx.Err() != nil {
+		return apperr.Wrap(apperr.UpstreamTimeout, err, provider+" did not answer in time")
+	}
+	return apperr.Wrap(apperr.UpstreamUnavailable, err, provider+" request failed")
+}
+
+// statusError classifies an unexpected status answered by a provider.
+func statusError(provider string, status int) error {
+	if status == http.StatusTooManyRequests {
+		return apperr.New(apperr.RateLimited, provider+" is rate limiting us")
+	}
+	return apperr.New(apperr.UpstreamUnavailable, fmt.Sprintf("%s answered %d", provider, status))
+}
+
+var BrasilApiProvider = NewCepProvider("brasilAPI", BrasilApiCep)
+
+// BrasilApiV2Provider keeps the name of BrasilApiProvider, CEP_PROVIDERS configures whichever is in use.
+var BrasilApiV2Provider = NewCepProvider("brasilAPI", BrasilApiCepV2)
+var ViaCepProvider = NewCepProvider("ViaCEP", ViaCep)
+
+type CepProviderConfig struct {
+	Enabled bool
+	// Timeout is the budget of a single lookup, zero means no extra limit.
+	Timeout time.Duration
+	// Priority decides, lower values first, which provider's field wins when the merge race mode
+	// joins the answers. The other race modes only start the lookups in this order.
+	Priority int
+}
+
+type RegisteredCepProvider struct {
+	CepProvider
+	Config CepProviderConfig
+}
+
+// CepRegistry holds every known CepProvider and how each one should be used.
+type CepRegistry struct {
+	mu        sync.RWMutex
+	providers []RegisteredCepProvider
+}
+
+func NewCepRegistry() *CepRegistry {
+	return &CepRegistry{}
+}
+
+// DefaultCepRegistry returns a registry with BrasilAPI, in the configured version, and ViaCEP enabled.
+func DefaultCepRegistry() *CepRegistry {
+	r := NewCepRegistry()
+	brasilApi := BrasilApiV2Provider
+	if brasilApiCepVersion == "v1" {
+		brasilApi = BrasilApiProvider
+	}
+	mustRegister(r, brasilApi, CepProviderConfig{Enabled: true, Timeout: requestExpirationTime, Priority: 0})
+	mustRegister(r, ViaCepProvider, CepProviderConfig{Enabled: true, Timeout: requestExpirationTime, Priority: 1})
+	return r
+}
+
+// mustRegister é para os providers padrão, que têm nomes fixos: um erro aqui é bug e para o boot.
+func mustRegister(r *CepRegistry, p CepProvider, cfg CepProviderConfig) {
+	err := r.Register(p, cfg)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (r *CepRegistry) Register(p CepProvider, cfg CepProviderConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registered := range r.providers {
+		if strings.EqualFold(registered.Name(), p.Name()) {
+			return fmt.Errorf("cep provider %q already registered", p.Name())
+		}
+	}
+	r.providers = append(r.providers, RegisteredCepProvider{CepProvider: p, Config: cfg})
+	return nil
+}
+
+// Configure replaces the config of an already registered provider.
+func (r *CepRegistry) Configure(name string, cfg CepProviderConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, registered := range r.providers {
+		if strings.EqualFold(registered.Name(), name) {
+			r.providers[i].Config = cfg
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown cep provider %q", name)
+}
+
+// Config returns the current config of a registered provider.
+func (r *CepRegistry) Config(name string) (CepProviderConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, registered := range r.providers {
+		if strings.EqualFold(registered.Name(), name) {
+			return registered.Config, true
+		}
+	}
+	return CepProviderConfig{}, false
+}
+
+// Providers returns the enabled providers ordered by priority.
+// Providers with the same priority keep their registration order.
+func (r *CepRegistry) Providers() []RegisteredCepProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	enabled := make([]RegisteredCepProvider, 0, len(r.providers))
+	for _, registered := range r.providers {
+		if registered.Config.Enabled {
+			enabled = append(enabled, registered)
+		}
+	}
+	sort.SliceStable(enabled, func(i, j int) bool {
+		return enabled[i].Config.Priority < enabled[j].Config.Priority
+	})
+	return enabled
+}
+
+// ApplySpec configures the registry from a spec string like
+//
+//	brasilAPI:priority=0,timeout=5s;ViaCEP:enabled=false
+//
+// Providers that are not listed keep their current config.
+func (r *CepRegistry) ApplySpec(spec string) error {
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		cfg, ok := r.Config(name)
+		if !ok {
+			return fmt.Errorf("unknown cep provider %q", name)
+		}
+
+		for _, option := range strings.Split(options, ",") {
+			option = strings.TrimSpace(option)
+			if option == "" {
+				continue
+			}
+			key, value, found := strings.Cut(option, "=")
+			if !found {
+				return fmt.Errorf("cep provider %s: option %q must be key=value", name, option)
+			}
+
+			var err error
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "enabled":
+				cfg.Enabled, err = strconv.ParseBool(value)
+			case "timeout":
+				cfg.Timeout, err = time.ParseDuration(value)
+			case "priority":
+				cfg.Priority, err = strconv.Atoi(value)
+			default:
+				err = fmt.Errorf("unknown option %q", key)
+			}
+			if err != nil {
+				return fmt.Errorf("cep provider %s: %w", name, err)
+			}
+		}
+
+		if err := r.Configure(name, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package external
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func fakeLookup(ctx context.Context, cep string) (Address, error) {
+	return Address{Cep: cep}, nil
+}
+
+func TestCepRegistryProvidersOrder(t *testing.T) {
+	registry := NewCepRegistry()
+	registry.Register(NewCepProvider("a", fakeLookup), CepProviderConfig{Enabled: true, Priority: 2})
+	registry.Register(NewCepProvider("b", fakeLookup), CepProviderConfig{Enabled: false, Priority: 0})
+	registry.Register(NewCepProvider("c", fakeLookup), CepProviderConfig{Enabled: true, Priority: 1})
+	registry.Register(NewCepProvider("d", fakeLookup), CepProviderConfig{Enabled: true, Priority: 1})
+
+	providers := registry.Providers()
+	expected := []string{"c", "d", "a"}
+	if len(providers) != len(expected) {
+		t.Fatalf("Providers() returned %d providers, expected %d", len(providers), len(expected))
+	}
+	for i, name := range expected {
+		if providers[i].Name() != name {
+			t.Errorf("Providers()[%d] = %s, expected %s", i, providers[i].Name(), name)
+		}
+	}
+}
+
+func TestCepRegistryDuplicatedProvider(t *testing.T) {
+	registry := NewCepRegistry()
+	registry.Register(NewCepProvider("a", fakeLookup), CepProviderConfig{Enabled: true})
+	err := registry.Register(NewCepProvider("A", fakeLookup), CepProviderConfig{Enabled: true})
+	if err == nil {
+		t.Errorf("Register() accepted a duplicated provider")
+	}
+}
+
+func TestCepRegistryApplySpec(t *testing.T) {
+	registry := DefaultCepRegistry()
+	err := registry.ApplySpec("viacep:priority=-1,timeout=2s; brasilAPI:enabled=false")
+	if err != nil {
+		t.Fatalf("ApplySpec() returned an error: %v", err)
+	}
+
+	providers := registry.Providers()
+	if len(providers) != 1 || providers[0].Name() != "ViaCEP" {
+		t.Fatalf("ApplySpec() did not disable brasilAPI: %v", providers)
+	}
+	if providers[0].Config.Timeout != 2*time.Second || providers[0].Config.Priority != -1 {
+		t.Errorf("ApplySpec() did not apply the ViaCEP options: %+v", providers[0].Config)
+	}
+
+	if err := registry.ApplySpec("unknown:enabled=true"); err == nil {
+		t.Errorf("ApplySpec() accepted an unknown provider")
+	}
+	if err := registry.ApplySpec("ViaCEP:timeout"); err == nil {
+		t.Errorf("ApplySpec() accepted an option without value")
+	}
+}
@@ -0,0 +1,80 @@
+package external
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReverseGeocoder é qualquer fonte capaz de achar o endereço, com CEP, mais próximo de uma coordenada.
+type ReverseGeocoder interface {
+	Name() string
+	Reverse(ctx context.Context, lat float64, lon float64) (Address, error)
+}
+
+type reverseGeocoderFunc struct {
+	name    string
+	reverse func(ctx context.Context, lat float64, lon float64) (Address, error)
+}
+
+func (g reverseGeocoderFunc) Name() string {
+	return g.name
+}
+
+func (g reverseGeocoderFunc) Reverse(ctx context.Context, lat float64, lon float64) (Address, error) {
+	return g.reverse(ctx, lat, lon)
+}
+
+// NewReverseGeocoder adapts a plain reverse function (like NominatimReverse) into a ReverseGeocoder.
+func NewReverseGeocoder(name string, reverse func(ctx context.Context, lat float64, lon float64) (Address, error)) ReverseGeocoder {
+	return reverseGeocoderFunc{name: name, reverse: reverse}
+}
+
+var NominatimGeocoder = NewReverseGeocoder("nominatim", NominatimReverse)
+
+// ReverseGeocoderByName returns the geocoder configured by name, nil for "none".
+func ReverseGeocoderByName(name string) (ReverseGeocoder, error) {
+	switch name {
+	case "nominatim":
+		return NominatimGeocoder, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown reverse geocoder %q", name)
+}
+
+// ForwardGeocoder é qualquer fonte capaz de achar as coordenadas de um endereço.
+type ForwardGeocoder interface {
+	Name() string
+	Forward(ctx context.Context, address Address) (Coordinates, error)
+}
+
+type forwardGeocoderFunc struct {
+	name    string
+	forward func(ctx context.Context, address Address) (Coordinates, error)
+}
+
+func (g forwardGeocoderFunc) Name() string {
+	return g.name
+}
+
+func (g forwardGeocoderFunc) Forward(ctx context.Context, address Address) (Coordinates, error) {
+	return g.forward(ctx, address)
+}
+
+// NewForwardGeocoder adapts a plain forward function (like NominatimSearch) into a ForwardGeocoder.
+func NewForwardGeocoder(name string, forward func(ctx context.Context, address Address) (Coordinates, error)) ForwardGeocoder {
+	return forwardGeocoderFunc{name: name, forward: forward}
+}
+
+var NominatimForwardGeocoder = NewForwardGeocoder("nominatim", NominatimSearch)
+
+// ForwardGeocoderByName returns the geocoder configured by name, nil for "none".
+func ForwardGeocoderByName(name string) (ForwardGeocoder, error) {
+	switch name {
+	case "nominatim":
+		return NominatimForwardGeocoder, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown forward geocoder %q", name)
+}
@@ -0,0 +1,230 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var nominatimUrl = "https://nominatim.openstreetmap.org"
+
+// geocodingUserAgent identifica o serviço, o Nominatim bloqueia clients sem User-Agent
+var geocodingUserAgent = "otel-cep/tempByCep"
+
+type nominatimAddress struct {
+	Postcode      string `json:"postcode"`
+	Road          string `json:"road"`
+	Suburb        string `json:"suburb"`
+	Neighbourhood string `json:"neighbourhood"`
+	City          string `json:"city"`
+	Town          string `json:"town"`
+	Village       string `json:"village"`
+	Municipality  string `json:"municipality"`
+	State         string `json:"state"`
+	// StateCode vem como "BR-RJ"
+	StateCode   string `json:"ISO3166-2-lvl4"`
+	CountryCode string `json:"country_code"`
+}
+
+type nominatimReverseResponse struct {
+	Error   string           `json:"error"`
+	Address nominatimAddress `json:"address"`
+}
+
+// NominatimReverse finds the address closest to lat,lon on OpenStreetMap. Cep stays empty
+// when OpenStreetMap only knows a partial postcode for the place.
+func NominatimReverse(ctx context.Context, lat float64, lon float64) (Address, error) {
+	ctx, externalSpan := otel.GetTracerProvider().Tracer("geocoding").Start(ctx, "nominatim-reverse-external")
+	defer externalSpan.End()
+
+	params := url.Values{}
+	params.Set("format", "jsonv2")
+	params.Set("addressdetails", "1")
+	params.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	params.Set("lon", strconv.FormatFloat(lon, 'f', -1, 64))
+	var body nominatimReverseResponse
+	err := nominatimGet(ctx, "/reverse", params, &body)
+	if err != nil {
+		return Address{}, err
+	}
+	if body.Error != "" {
+		return Address{}, apperr.New(apperr.NotFound, fmt.Sprintf("no address found near %v,%v: %s", lat, lon, body.Error))
+	}
+	if body.Address.CountryCode != "br" {
+		return Address{}, apperr.New(apperr.InvalidInput, fmt.Sprintf("%v,%v is outside Brazil", lat, lon))
+	}
+	return body.Address.toAddress(), nil
+}
+
+type nominatimSearchResult struct {
+	// lat e lon vêm como string
+	Lat string `json:"lat"`
+	Lon string `json:"lon"`
+}
+
+// NominatimSearch finds the coordinates of address on OpenStreetMap. When the street is unknown
+// to OpenStreetMap it settles for the coordinates of the city.
+func NominatimSearch(ctx context.Context, address Address) (Coordinates, error) {
+	ctx, externalSpan := otel.GetTracerProvider().Tracer("geocoding").Start(ctx, "nominatim-search-external")
+	defer externalSpan.End()
+
+	if address.City == "" {
+		return Coordinates{}, apperr.New(apperr.InvalidInput, "address has no city to search for")
+	}
+	var queries []string
+	if address.Street != "" {
+		queries = append(queries, address.Street+", "+address.City+", "+address.State)
+	}
+	queries = append(queries, address.City+", "+address.State)
+
+	for _, q := range queries {
+		params := url.Values{}
+		params.Set("format", "jsonv2")
+		params.Set("countrycodes", "br")
+		params.Set("limit", "1")
+		params.Set("q", q)
+		var results []nominatimSearchResult
+		err := nominatimGet(ctx, "/search", params, &results)
+		if err != nil {
+			return Coordinates{}, err
+		}
+		if len(results) == 0 {
+			externalSpan.AddEvent("nominatim found nothing", trace.WithAttributes(attribute.String("q", q)))
+			continue
+		}
+
+		lat, latErr := strconv.ParseFloat(results[0].Lat, 64)
+		lon, lonErr := strconv.ParseFloat(results[0].Lon, 64)
+		if err := errors.Join(latErr, lonErr); err != nil {
+			return Coordinates{}, apperr.Wrap(apperr.UpstreamUnavailable, err, "nominatim answered invalid coordinates")
+		}
+		externalSpan.SetAttributes(attribute.String("q", q))
+		return Coordinates{Lat: lat, Lon: lon, Source: "nominatim"}, nil
+	}
+	return Coordinates{}, apperr.New(apperr.NotFound, fmt.Sprintf("no coordinates found for %s, %s", address.City, address.State))
+}
+
+// nominatimInterval é o intervalo mínimo entre duas requests do processo,
+// a política de uso do Nominatim público pede no máximo uma por segundo
+var nominatimInterval = time.Second
+
+var nominatimLimiter = &intervalLimiter{}
+
+// intervalLimiter spaces calls at least interval apart, in the order they arrive.
+type intervalLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the caller's turn. A turn that would only come after the ctx deadline is not
+// taken, so callers with a short budget give up right away instead of holding back the others.
+func (l *intervalLimiter) wait(ctx context.Context, interval time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	turn := l.next
+	if turn.Before(now) {
+		turn = now
+	}
+	if deadline, ok := ctx.Deadline(); ok && turn.After(deadline) {
+		l.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	l.next = turn.Add(interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(turn.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nominatimGet faz o GET no Nominatim e decodifica o json em out, os erros ficam no span do caller.
+func nominatimGet(ctx context.Context, path string, params url.Values, out any) error {
+	span := trace.SpanFromContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, requestExpirationTime)
+	defer cancel()
+
+	err := nominatimLimiter.wait(ctx, nominatimInterval)
+	if err != nil {
+		err = apperr.Wrap(apperr.UpstreamTimeout, err, "no nominatim request slot left in time")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, apperr.Message(err))
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", nominatimUrl+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", geocodingUserAgent)
+	req.Header.Set("Accept-Language", "pt-BR")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		err = lookupError(ctx, "nominatim", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, apperr.Message(err))
+		return err
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		err = statusError("nominatim", resp.StatusCode)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, resp.Status)
+		return err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return lookupError(ctx, "nominatim", err)
+	}
+	return nil
+}
+
+func (a nominatimAddress) toAddress() Address {
+	address := Address{
+		State:        a.State,
+		City:         firstNonEmpty(a.City, a.Town, a.Village, a.Municipality),
+		Neighborhood: firstNonEmpty(a.Suburb, a.Neighbourhood),
+		Street:       a.Road,
+		Source:       "nominatim",
+	}
+	// a sigla, como nos providers de CEP
+	if uf, ok := strings.CutPrefix(a.StateCode, "BR-"); ok {
+		address.State = uf
+	}
+	cep := strings.ReplaceAll(a.Postcode, "-", "")
+	if utils.ValidateCep(cep) == nil {
+		address.Cep = cep
+	}
+	return address
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+)
+
+// withFakeNominatim aponta o client do Nominatim para um servidor de teste.
+func withFakeNominatim(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous, previousInterval := nominatimUrl, nominatimInterval
+	// o servidor de teste não tem limite de uso
+	nominatimUrl, nominatimInterval = server.URL, 0
+	t.Cleanup(func() {
+		server.Close()
+		nominatimUrl, nominatimInterval = previous, previousInterval
+	})
+}
+
+func TestIntervalLimiterSpacesCalls(t *testing.T) {
+	limiter := &intervalLimiter{}
+	interval := 50 * time.Millisecond
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		err := limiter.wait(context.Background(), interval)
+		if err != nil {
+			t.Fatalf("wait() returned an error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("wait() let 3 calls through in %v, expected at least %v", elapsed, 2*interval)
+	}
+
+	// a vez só chegaria depois do prazo, desiste sem ocupar a fila
+	ctx, cancel := context.WithTimeout(context.Background(), interval/5)
+	defer cancel()
+	err := limiter.wait(ctx, interval)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait() returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+	limiter.mu.Lock()
+	next := limiter.next
+	limiter.mu.Unlock()
+	if next.After(start.Add(3*interval + interval/2)) {
+		t.Errorf("wait() reserved a turn for a caller that gave up")
+	}
+}
+
+func TestNominatimReverse(t *testing.T) {
+	var userAgent, lat string
+	withFakeNominatim(t, func(w http.ResponseWriter, r *http.Request) {
+		userAgent, lat = r.Header.Get("User-Agent"), r.URL.Query().Get("lat")
+		w.Write([]byte(`{"address":{"road":"Rua Pereira Nunes","suburb":"Vila Isabel","city":"Rio de Janeiro",
+			"state":"Rio de Janeiro","ISO3166-2-lvl4":"BR-RJ","postcode":"20541-155","country_code":"br"}}`))
+	})
+
+	address, err := NominatimReverse(context.Background(), -22.9163, -43.2437)
+	if err != nil {
+		t.Fatalf("NominatimReverse() returned an error: %v", err)
+	}
+	expected := Address{Cep: "20541155", State: "RJ", City: "Rio de Janeiro", Neighborhood: "Vila Isabel", Street: "Rua Pereira Nunes", Source: "nominatim"}
+	if address.Cep != expected.Cep || address.State != expected.State || address.City != expected.City ||
+		address.Neighborhood != expected.Neighborhood || address.Street != expected.Street || address.Source != expected.Source {
+		t.Errorf("NominatimReverse() returned %+v, expected %+v", address, expected)
+	}
+	if userAgent == "" || lat != "-22.9163" {
+		t.Errorf("NominatimReverse() sent User-Agent %q and lat %q", userAgent, lat)
+	}
+}
+
+func TestNominatimReverseKeepsOnlyFullCep(t *testing.T) {
+	withFakeNominatim(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"address":{"town":"Parati","ISO3166-2-lvl4":"BR-RJ","postcode":"23970","country_code":"br"}}`))
+	})
+
+	address, err := NominatimReverse(context.Background(), -23.22, -44.71)
+	if err != nil || address.Cep != "" || address.City != "Parati" {
+		t.Errorf("NominatimReverse() returned %+v, %v", address, err)
+	}
+}
+
+func TestNominatimReverseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		kind   *apperr.Kind
+	}{
+		{"ocean", http.StatusOK, `{"error":"Unable to geocode"}`, apperr.NotFound},
+		{"abroad", http.StatusOK, `{"address":{"city":"Montevideo","country_code":"uy"}}`, apperr.InvalidInput},
+		{"rate limited", http.StatusTooManyRequests, ``, apperr.RateLimited},
+		{"unavailable", http.StatusInternalServerError, ``, apperr.UpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		withFakeNominatim(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		})
+
+		_, err := NominatimReverse(context.Background(), -30, -40)
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("NominatimReverse() returned %v for %s, expected %v", err, tt.name, tt.kind)
+		}
+	}
+}
+
+func TestNominatimSearch(t *testing.T) {
+	var queries []string
+	withFakeNominatim(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q"))
+		if r.URL.Path != "/search" || r.URL.Query().Get("countrycodes") != "br" {
+			t.Errorf("NominatimSearch() asked for %s", r.URL)
+		}
+		w.Write([]byte(`[{"lat":"-22.9163","lon":"-43.2437","display_name":"Rua Pereira Nunes, Vila Isabel"}]`))
+	})
+
+	coordinates, err := NominatimSearch(context.Background(), Address{Street: "Rua Pereira Nunes", City: "Rio de Janeiro", State: "RJ"})
+	if err != nil || coordinates != (Coordinates{Lat: -22.9163, Lon: -43.2437, Source: "nominatim"}) {
+		t.Errorf("NominatimSearch() returned %+v, %v", coordinates, err)
+	}
+	if len(queries) != 1 || queries[0] != "Rua Pereira Nunes, Rio de Janeiro, RJ" {
+		t.Errorf("NominatimSearch() searched for %v", queries)
+	}
+}
+
+func TestNominatimSearchFallsBackToCity(t *testing.T) {
+	var queries []string
+	withFakeNominatim(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		queries = append(queries, q)
+		if q == "Parati, RJ" {
+			w.Write([]byte(`[{"lat":"-23.2178","lon":"-44.7131"}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+
+	coordinates, err := NominatimSearch(context.Background(), Address{Street: "Rua Sem Nome", City: "Parati", State: "RJ"})
+	if err != nil || coordinates.Lat != -23.2178 || coordinates.Lon != -44.7131 {
+		t.Errorf("NominatimSearch() returned %+v, %v", coordinates, err)
+	}
+	if len(queries) != 2 {
+		t.Errorf("NominatimSearch() searched for %v, expected the street and then the city", queries)
+	}
+
+	_, err = NominatimSearch(context.Background(), Address{City: "Lugar Nenhum", State: "RJ"})
+	if !errors.Is(err, apperr.NotFound) {
+		t.Errorf("NominatimSearch() returned %v, expected %v", err, apperr.NotFound)
+	}
+	_, err = NominatimSearch(context.Background(), Address{Cep: "20541155"})
+	if !errors.Is(err, apperr.InvalidInput) {
+		t.Errorf("NominatimSearch() returned %v without a city, expected %v", err, apperr.InvalidInput)
+	}
+}
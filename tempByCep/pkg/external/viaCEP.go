@@ -3,8 +3,6 @@ package external
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"go.opentelemetry.io/otel"
 	"io"
 	"net/http"
@@ -12,6 +10,8 @@ import (
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
 )
 
+var viaCepUrl = "http://viacep.com.br/ws"
+
 type AddressDataViaCep struct {
 	Cep          string `json:"cep"`
 	State        string `json:"uf"`
@@ -32,7 +32,7 @@ func ViaCep(ctx context.Context, cep string) (Address, error) {
 	// o contexto expira em 1 segundo!
 	ctx, cancel := context.WithTimeout(ctx, requestExpirationTime)
 	defer cancel() // de alguma forma nosso contexto será cancelado
-	req, err := http.NewRequestWithContext(ctx, "GET", "http://viacep.com.br/ws/"+cep+"/json/", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", viaCepUrl+"/"+cep+"/json/", nil)
 
 	if err != nil {
 		return Address{}, err
@@ -42,24 +42,22 @@ func ViaCep(ctx context.Context, cep string) (Address, error) {
 	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
-		return Address{}, err
+		return Address{}, lookupError(ctx, "ViaCEP", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		// ViaCEP só responde 400 para formato inválido, que já foi validado
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return Address{}, statusError("ViaCEP", resp.StatusCode)
+		}
 		return Address{}, utils.ZipNotFoundError
-
-	}
-
-	if ctx.Err() == context.DeadlineExceeded {
-		fmt.Println("Api fetch timeout exceeed.")
-		return Address{}, errors.New("api fetch timeout exceeed")
 	}
 
 	// depois de tudo termina e faz o body
-	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return Address{}, err
+		return Address{}, lookupError(ctx, "ViaCEP", err)
 	}
 	var jsonData AddressDataViaCep
 	err = json.Unmarshal(body, &jsonData)
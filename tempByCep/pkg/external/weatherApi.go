@@ -6,15 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/secret"
 )
 
-type searchReturn struct {
+// SearchResult is a location matched by SearchLocations, Url is WeatherAPI's own id for queries.
+type SearchResult struct {
 	Id      int32   `json:"id"`
 	Name    string  `json:"name"`
 	Region  string  `json:"region"`
@@ -172,8 +181,51 @@ type Hour struct {
 }
 
 type Marine struct {
-	Location *Location
-	Forecast *ForecastBase
+	Location *Location           `json:"location"`
+	Forecast *MarineForecastBase `json:"forecast"`
+}
+
+type MarineForecastBase struct {
+	ForecastDay *[]MarineForecastDay `json:"forecastday"`
+}
+
+type MarineForecastDay struct {
+	Date string        `json:"date"`
+	Day  *MarineDay    `json:"day"`
+	Hour *[]MarineHour `json:"hour"`
+}
+
+type MarineDay struct {
+	MaxtempC  float32        `json:"maxtemp_c"`
+	MintempC  float32        `json:"mintemp_c"`
+	Condition *Condition     `json:"condition"`
+	Tides     *[]MarineTides `json:"tides"`
+}
+
+type MarineTides struct {
+	Tide *[]Tide `json:"tide"`
+}
+
+// Tide is a high or low tide, WeatherAPI sends the height as a string.
+type Tide struct {
+	TideTime     string      `json:"tide_time"`
+	TideHeightMt json.Number `json:"tide_height_mt"`
+	TideType     string      `json:"tide_type"`
+}
+
+type MarineHour struct {
+	TimeEpoch       float32    `json:"time_epoch"`
+	Time            string     `json:"time"`
+	TempC           float32    `json:"temp_c"`
+	Condition       *Condition `json:"condition"`
+	WindKph         float32    `json:"wind_kph"`
+	WindDir         string     `json:"wind_dir"`
+	SigHtMt         float32    `json:"sig_ht_mt"`
+	SwellHtMt       float32    `json:"swell_ht_mt"`
+	SwellDir        float32    `json:"swell_dir"`
+	SwellDir16Point string     `json:"swell_dir_16_point"`
+	SwellPeriodSecs float32    `json:"swell_period_secs"`
+	WaterTempC      float32    `json:"water_temp_c"`
 }
 
 type AstronomyBase struct {
@@ -206,58 +258,196 @@ type TimeZone struct {
 	Location *Location `json:"location"`
 }
 
-const apiKey = "cf7ea6d61fd247d78e9171401240206"
-const baseUrl = "https://api.weatherapi.com/v1"
+// apiKeySource é lido a cada request, assim uma chave rotacionada vale sem restart
+var apiKeySource secret.Source = secret.Env("WEATHER_API_KEY")
+var baseUrl = "https://api.weatherapi.com/v1"
+
+var weatherRequestExpirationTime = 3 * time.Second
+
+// ErrMissingAPIKey means the WeatherAPI key is not configured or could not be read.
+var ErrMissingAPIKey = apperr.New(apperr.Misconfigured, "weatherapi key is not configured")
+
+// códigos de erro documentados em https://www.weatherapi.com/docs/#intro-error-codes
+const (
+	weatherNoLocationFound = 1006
+	weatherInvalidKey      = 2006
+	weatherQuotaExceeded   = 2007
+	weatherKeyDisabled     = 2008
+)
+
+type weatherErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// weatherStatusError classifies a WeatherAPI error answer by its status and error code.
+func weatherStatusError(path string, status int, body []byte) error {
+	var parsed weatherErrorResponse
+	json.Unmarshal(body, &parsed)
+	cause := fmt.Errorf("weatherapi %s answered %d: %s", path, status, parsed.Error.Message)
+
+	switch {
+	case parsed.Error.Code == weatherNoLocationFound:
+		return apperr.Wrap(apperr.NotFound, cause, "location not found")
+	case parsed.Error.Code == weatherQuotaExceeded || status == http.StatusTooManyRequests:
+		return apperr.Wrap(apperr.RateLimited, cause, "weatherapi quota exceeded")
+	case parsed.Error.Code == weatherInvalidKey || parsed.Error.Code == weatherKeyDisabled ||
+		status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return apperr.Wrap(apperr.Misconfigured, cause, "weatherapi key was rejected")
+	default:
+		return apperr.Wrap(apperr.UpstreamUnavailable, cause, "weatherapi request failed")
+	}
+}
+
+// Settings are the values of this package that come from the service config.
+type Settings struct {
+	CepRequestTimeout     time.Duration
+	BrasilAPICepVersion   string
+	WeatherBaseURL        string
+	WeatherAPIKey         secret.Source
+	WeatherRequestTimeout time.Duration
+	NominatimBaseURL      string
+	GeocodingUserAgent    string
+}
+
+// Configure replaces the package defaults, it must be called before any request is made.
+func Configure(s Settings) {
+	requestExpirationTime = s.CepRequestTimeout
+	brasilApiCepVersion = s.BrasilAPICepVersion
+	baseUrl = strings.TrimSuffix(s.WeatherBaseURL, "/")
+	apiKeySource = s.WeatherAPIKey
+	weatherRequestExpirationTime = s.WeatherRequestTimeout
+	nominatimUrl = strings.TrimSuffix(s.NominatimBaseURL, "/")
+	geocodingUserAgent = s.GeocodingUserAgent
+}
+
+// RequestTimeoutError is returned when a WeatherAPI call could not finish
+// because its budget expired or the caller gave up (client disconnected).
+type RequestTimeoutError struct {
+	Path string
+	Err  error
+}
+
+func (e *RequestTimeoutError) Error() string {
+	return fmt.Sprintf("weatherapi %s did not answer in time: %v", e.Path, e.Err)
+}
+
+func (e *RequestTimeoutError) Unwrap() []error {
+	return []error{apperr.UpstreamTimeout, e.Err}
+}
+
+// asTimeout troca o erro pelo RequestTimeoutError quando o contexto da chamada acabou.
+func asTimeout(ctx context.Context, path string, err error) error {
+	if ctx.Err() != nil {
+		return &RequestTimeoutError{Path: path, Err: ctx.Err()}
+	}
+	return err
+}
+
+// responseBody só cancela o contexto da chamada e fecha o span quando o body é fechado,
+// assim quem chamou doRequest ainda consegue ler o body dentro do prazo.
+type responseBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	path   string
+	cancel context.CancelFunc
+	span   trace.Span
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = asTimeout(b.ctx, b.path, err)
+		b.span.RecordError(err)
+	}
+	return n, err
+}
 
-const weatherRequestExpirationTime = 60 * time.Second
+func (b *responseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	b.span.End()
+	return err
+}
 
+// doRequest calls WeatherAPI within weatherRequestExpirationTime, honoring the cancellation of ctx.
+// The caller must close the response body.
 func doRequest(ctx context.Context, method string, path string, params map[string]string) (*http.Response, error) {
 	path = strings.ReplaceAll(path, "/", "")
 	method = strings.ToUpper(method)
 
-	//newPath := ctx.Value("method")
+	ctx, externalSpan := otel.GetTracerProvider().Tracer("weather").Start(ctx, "weather-external-"+path,
+		trace.WithSpanKind(trace.SpanKindClient))
+	ctx, cancel := context.WithTimeout(ctx, weatherRequestExpirationTime)
 
-	ctx, externalSpan := otel.GetTracerProvider().Tracer("weather").Start(ctx, "weather-external-"+path)
-	defer externalSpan.End()
-
-	//ctx := context.Background()
-	//ctx, cancel := context.WithTimeout(ctx, weatherRequestExpirationTime)
-	//defer cancel() // de alguma forma nosso contexto será cancelado
+	// até o body ser entregue, quem encerra span e contexto é o doRequest
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			cancel()
+			externalSpan.End()
+		}
+	}()
 
 	u, err := url.Parse(baseUrl + "/" + path)
 	if err != nil {
 		return nil, err
 	}
 
-	// add api key
-	params["key"] = apiKey
-
 	//parseando e adicionando do map
 	q := u.Query()
 	for k, v := range params {
 		q.Set(k, v)
 	}
 	u.RawQuery = q.Encode()
+	// a chave não pode ir para o trace
+	externalSpan.SetAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", u.String()),
+	)
 
-	//req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
-	req, err := http.NewRequest(method, u.String(), nil)
+	// add api key
+	key, err := apiKeySource.Value()
+	if err != nil {
+		externalSpan.RecordError(err)
+		return nil, fmt.Errorf("%w: %v", ErrMissingAPIKey, err)
+	}
+	q.Set("key", key)
+	u.RawQuery = q.Encode()
 
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
+	// propagar otel! na request
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	// faz a request
 	resp, err := http.DefaultClient.Do(req)
-
 	if err != nil {
+		err = asTimeout(ctx, path, err)
+		if apperr.KindOf(err) == nil {
+			err = apperr.Wrap(apperr.UpstreamUnavailable, err, "weatherapi request failed")
+		}
+		externalSpan.RecordError(err)
+		externalSpan.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	externalSpan.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		// o body de erro não tem location/current, melhor não deixar o caller decodificar
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		err = weatherStatusError(path, resp.StatusCode, body)
+		externalSpan.RecordError(err)
+		externalSpan.SetStatus(codes.Error, resp.Status)
 		return nil, err
 	}
 
-	//if ctx.Err() == context.DeadlineExceeded {
-	//	fmt.Println("Api fetch timeout exceeed.")
-	//	return nil, errors.New("Api fetch timeout exceeed.")
-	//}
-
+	resp.Body = &responseBody{ReadCloser: resp.Body, ctx: ctx, path: path, cancel: cancel, span: externalSpan}
+	handedOff = true
 	return resp, nil
 }
 
@@ -268,18 +458,17 @@ func CurrentWeather(ctx context.Context, query string, lang string) (CurrentMode
 		"lang": lang,
 	}
 
-	ctx = context.WithValue(ctx, "method", "CurrentWeather")
-
 	// Make the request
 	resp, err := doRequest(ctx, "GET", "current.json", params)
 	if err != nil {
 		return CurrentModel{}, err
 	}
+	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return CurrentModel{}, fmt.Errorf("reading response body: %v", err)
+		return CurrentModel{}, fmt.Errorf("reading response body: %w", err)
 	}
 
 	// Unmarshal the JSON response into a Current struct
@@ -288,12 +477,23 @@ func CurrentWeather(ctx context.Context, query string, lang string) (CurrentMode
 	if err != nil {
 		return CurrentModel{}, fmt.Errorf("unmarshalling response body: %v", err)
 	}
+	if current.Location == nil || current.Current == nil {
+		return CurrentModel{}, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without current weather")
+	}
 
 	// Return the current weather data
 	return current, nil
 }
 
-func forecast(ctx context.Context, query string, lang string, days int) (Forecast, error) {
+// ForecastMaxDays é o máximo de dias que a WeatherAPI prevê
+const ForecastMaxDays = 14
+
+// ForecastWeather returns the forecast for the next days (1 to ForecastMaxDays), today included.
+func ForecastWeather(ctx context.Context, query string, lang string, days int) (Forecast, error) {
+	if days < 1 || days > ForecastMaxDays {
+		return Forecast{}, apperr.New(apperr.InvalidInput, fmt.Sprintf("days should be between 1 and %d", ForecastMaxDays))
+	}
+
 	// Define the parameters for the request
 	params := map[string]string{
 		"q":    query,
@@ -306,11 +506,12 @@ func forecast(ctx context.Context, query string, lang string, days int) (Forecas
 	if err != nil {
 		return Forecast{}, err
 	}
+	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return Forecast{}, fmt.Errorf("reading response body: %v", err)
+		return Forecast{}, fmt.Errorf("reading response body: %w", err)
 	}
 
 	// Unmarshal the JSON response into a Forecast struct
@@ -319,24 +520,30 @@ func forecast(ctx context.Context, query string, lang string, days int) (Forecas
 	if err != nil {
 		return Forecast{}, fmt.Errorf("unmarshalling response body: %v", err)
 	}
+	if forecast.Location == nil || forecast.Forecast == nil || forecast.Forecast.ForecastDay == nil {
+		return Forecast{}, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without forecast")
+	}
 
 	// Return the forecast data
 	return forecast, nil
 }
 
-func ip(ctx context.Context, ipaddress string) (IP, error) {
-	// Remove all dots from the IP address
-	ipaddress = strings.ReplaceAll(ipaddress, ".", "")
-
-	// Convert the IP address to an integer
-	ipInt, err := strconv.ParseInt(ipaddress, 10, 32)
+// LookupIP returns where WeatherAPI locates the public address ipaddress, IPv4 or IPv6. Private,
+// loopback and other non routable addresses are rejected before asking WeatherAPI.
+func LookupIP(ctx context.Context, ipaddress string) (IP, error) {
+	addr, err := netip.ParseAddr(ipaddress)
 	if err != nil {
-		return IP{}, fmt.Errorf("converting IP address to integer: %v", err)
+		return IP{}, apperr.Wrap(apperr.InvalidInput, err, fmt.Sprintf("%q is not an ip address", ipaddress))
+	}
+	// IPv4 mapeado em IPv6 (::ffff:1.2.3.4) vira o IPv4
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return IP{}, apperr.New(apperr.InvalidInput, fmt.Sprintf("%s is not a public ip address", addr))
 	}
 
 	// Define the parameters for the request
 	params := map[string]string{
-		"q": strconv.FormatInt(ipInt, 10),
+		"q": addr.String(),
 	}
 
 	// Make the request
@@ -344,11 +551,12 @@ func ip(ctx context.Context, ipaddress string) (IP, error) {
 	if err != nil {
 		return IP{}, err
 	}
+	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return IP{}, fmt.Errorf("reading response body: %v", err)
+		return IP{}, fmt.Errorf("reading response body: %w", err)
 	}
 
 	// Unmarshal the JSON response into an IP struct
@@ -357,51 +565,66 @@ func ip(ctx context.Context, ipaddress string) (IP, error) {
 	if err != nil {
 		return IP{}, fmt.Errorf("unmarshalling response body: %v", err)
 	}
+	if ip.City == "" && ip.Lat == 0 && ip.Lon == 0 {
+		return IP{}, apperr.New(apperr.NotFound, fmt.Sprintf("weatherapi could not locate %s", addr))
+	}
 
 	// Return the IP data
 	return ip, nil
 }
 
-func search(ctx context.Context, toSearch string) (searchReturn, error) {
+// SearchLocations returns every location WeatherAPI matches for toSearch, in its order of relevance.
+// No match is an empty slice, not an error.
+func SearchLocations(ctx context.Context, toSearch string) ([]SearchResult, error) {
 	param := map[string]string{"q": toSearch}
 	resp, err := doRequest(ctx, "GET", "search.json", param)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 
 	if err != nil {
-		return searchReturn{}, fmt.Errorf("reading response body: %v", err)
+		return nil, fmt.Errorf("reading response body: %w", err)
 	}
-	var results []searchReturn
+	results := []SearchResult{}
 	err = json.Unmarshal(body, &results)
 	if err != nil {
-		return searchReturn{}, fmt.Errorf("unmarshalling response body: %v", err)
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "weatherapi answered an invalid search")
 	}
 
-	if len(results) == 0 {
-		return searchReturn{}, fmt.Errorf("no results returned")
-	}
-
-	return results[0], nil
+	return results, nil
 }
 
-func future(ctx context.Context, query string, lang string, date string) (Forecast, error) {
+// o plano free da WeatherAPI só projeta o futuro entre 14 e 300 dias
+const (
+	FutureMinDays = 14
+	FutureMaxDays = 300
+)
+
+// FutureWeather returns the projected weather of date (YYYY-MM-DD), which must be between FutureMinDays
+// and FutureMaxDays from today. Today is the current date at the location of query, not of the server.
+func FutureWeather(ctx context.Context, query string, lang string, date string) (Forecast, error) {
 	// Parse the date string into a time.Time value
 	dt, err := time.Parse("2006-01-02", date)
 	if err != nil {
-		return Forecast{}, fmt.Errorf("parsing date: %v", err)
+		return Forecast{}, apperr.Wrap(apperr.InvalidInput, err, "date should be in the format YYYY-MM-DD")
 	}
 
-	// Get the current date
-	now := time.Now()
-
-	// Calculate the difference between the current date and the provided date
-	diff := dt.Sub(now).Hours() / 24
+	// o dia de hoje depende do fuso da cidade
+	zone, err := LocationTimeZone(ctx, query)
+	if err != nil {
+		return Forecast{}, err
+	}
+	today, err := locationToday(zone.Location)
+	if err != nil {
+		return Forecast{}, err
+	}
 
 	// Check if the date is between 14 and 300 days from today
-	if diff < 14 || diff > 300 {
-		return Forecast{}, errors.New("date should be between 14 and 300 days from today")
+	diff := int(dt.Sub(today).Hours() / 24)
+	if diff < FutureMinDays || diff > FutureMaxDays {
+		return Forecast{}, apperr.New(apperr.InvalidInput, fmt.Sprintf("date should be between %d and %d days from today (%s)", FutureMinDays, FutureMaxDays, today.Format("2006-01-02")))
 	}
 
 	// Define the parameters for the request
@@ -416,11 +639,12 @@ func future(ctx context.Context, query string, lang string, date string) (Foreca
 	if err != nil {
 		return Forecast{}, err
 	}
+	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return Forecast{}, fmt.Errorf("reading response body: %v", err)
+		return Forecast{}, fmt.Errorf("reading response body: %w", err)
 	}
 
 	// Unmarshal the JSON response into a Forecast struct
@@ -430,11 +654,16 @@ func future(ctx context.Context, query string, lang string, date string) (Foreca
 		return Forecast{}, fmt.Errorf("unmarshalling response body: %v", err)
 	}
 
+	if forecast.Location == nil || forecast.Forecast == nil || forecast.Forecast.ForecastDay == nil {
+		return Forecast{}, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without forecast")
+	}
+
 	// Return the forecast data
 	return forecast, nil
 }
 
-func timezone(ctx context.Context, query string) (TimeZone, error) {
+// LocationTimeZone returns the location of query with its IANA time zone (TzID) and local time.
+func LocationTimeZone(ctx context.Context, query string) (TimeZone, error) {
 	params := map[string]string{
 		"q": query,
 	}
@@ -442,22 +671,98 @@ func timezone(ctx context.Context, query string) (TimeZone, error) {
 	if err != nil {
 		return TimeZone{}, err
 	}
+	defer response.Body.Close()
 
 	dataJson, err := io.ReadAll(response.Body)
 	if err != nil {
-		return TimeZone{}, errors.New("Error reading response body")
+		return TimeZone{}, fmt.Errorf("reading response body: %w", err)
 
 	}
 	location := TimeZone{}
 	err = json.Unmarshal(dataJson, &location)
 	if err != nil {
-		return TimeZone{}, errors.New("Error unmarshalling response body")
+		return TimeZone{}, fmt.Errorf("unmarshalling response body: %v", err)
+	}
+	if location.Location == nil || location.Location.TzID == "" {
+		return TimeZone{}, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without time zone")
 	}
 
 	return location, nil
 }
 
-func astronomy(ctx context.Context, query string, date string) (Astronomy, error) {
+// locationToday is the current date at location, at midnight in UTC so that dates can be subtracted.
+func locationToday(location *Location) (time.Time, error) {
+	if location == nil {
+		return time.Time{}, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without location")
+	}
+	// localtime já vem no fuso da cidade: "2024-05-01 9:30"
+	date, _, _ := strings.Cut(location.Localtime, " ")
+	today, err := time.Parse("2006-01-02", date)
+	if err == nil {
+		return today, nil
+	}
+	zone, err := time.LoadLocation(location.TzID)
+	if err != nil {
+		return time.Time{}, apperr.Wrap(apperr.UpstreamUnavailable, err, "weatherapi answered an unknown location time")
+	}
+	now := time.Now().In(zone)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// LocationZone is the time zone of location. Without the tz database for TzID it falls back
+// to the fixed offset between Localtime and LocaltimeEpoch.
+func LocationZone(location *Location) (*time.Location, error) {
+	if location == nil {
+		return nil, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without location")
+	}
+	zone, err := time.LoadLocation(location.TzID)
+	if err == nil {
+		return zone, nil
+	}
+	offset, offsetErr := LocaltimeOffset(location)
+	if offsetErr != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "weatherapi answered an unknown time zone "+location.TzID)
+	}
+	return time.FixedZone(location.TzID, int(offset.Seconds())), nil
+}
+
+// LocaltimeOffset is the UTC offset WeatherAPI implies for location, Localtime minus LocaltimeEpoch.
+func LocaltimeOffset(location *Location) (time.Duration, error) {
+	localtime, err := time.Parse("2006-01-02 15:04", location.Localtime)
+	if err != nil {
+		return 0, err
+	}
+	if location.LocaltimeEpoch == 0 {
+		return 0, errors.New("localtime_epoch is missing")
+	}
+	// o epoch vem em float32, só dá para confiar nele em minutos
+	return localtime.Sub(time.Unix(int64(location.LocaltimeEpoch), 0)).Round(15 * time.Minute), nil
+}
+
+// a WeatherAPI só tem dados de astronomia a partir de 2015
+var astronomyFirstDate = time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// AstronomyWeather returns sun and moon data of date (YYYY-MM-DD), or of today at the location when date is empty.
+func AstronomyWeather(ctx context.Context, query string, date string) (Astronomy, error) {
+	if date == "" {
+		zone, err := LocationTimeZone(ctx, query)
+		if err != nil {
+			return Astronomy{}, err
+		}
+		today, err := locationToday(zone.Location)
+		if err != nil {
+			return Astronomy{}, err
+		}
+		date = today.Format("2006-01-02")
+	}
+	dt, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return Astronomy{}, apperr.Wrap(apperr.InvalidInput, err, "date should be in the format YYYY-MM-DD")
+	}
+	if dt.Before(astronomyFirstDate) {
+		return Astronomy{}, apperr.New(apperr.InvalidInput, "date should be on or after 2015-01-01")
+	}
+
 	// Define the parameters for the request
 	params := map[string]string{
 		"q":  query,
@@ -469,11 +774,12 @@ func astronomy(ctx context.Context, query string, date string) (Astronomy, error
 	if err != nil {
 		return Astronomy{}, err
 	}
+	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return Astronomy{}, fmt.Errorf("reading response body: %v", err)
+		return Astronomy{}, fmt.Errorf("reading response body: %w", err)
 	}
 
 	// Unmarshal the JSON response into an Astronomy struct
@@ -483,11 +789,23 @@ func astronomy(ctx context.Context, query string, date string) (Astronomy, error
 		return Astronomy{}, fmt.Errorf("unmarshalling response body: %v", err)
 	}
 
+	if astronomy.Location == nil || astronomy.Astronomy == nil || astronomy.Astronomy.Astro == nil {
+		return Astronomy{}, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without astronomy")
+	}
+
 	// Return the astronomy data
 	return astronomy, nil
 }
 
-func marine(ctx context.Context, query string, lang string, days int, date string, unixdt int, hour int) (Marine, error) {
+// MarineMaxDays é o máximo de dias de previsão marítima da WeatherAPI
+const MarineMaxDays = 7
+
+// MarineWeather returns tides and waves for the next days (1 to MarineMaxDays). The optional date, unixdt
+// and hour restrict the answer, WeatherAPI answers for any query but the data only makes sense on the coast.
+func MarineWeather(ctx context.Context, query string, lang string, days int, date string, unixdt int, hour int) (Marine, error) {
+	if days < 1 || days > MarineMaxDays {
+		return Marine{}, apperr.New(apperr.InvalidInput, fmt.Sprintf("days should be between 1 and %d", MarineMaxDays))
+	}
 	params := map[string]string{
 		"q":    query,
 		"days": strconv.Itoa(days),
@@ -512,11 +830,12 @@ func marine(ctx context.Context, query string, lang string, days int, date strin
 	if err != nil {
 		return Marine{}, err
 	}
+	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return Marine{}, fmt.Errorf("reading response body: %v", err)
+		return Marine{}, fmt.Errorf("reading response body: %w", err)
 	}
 
 	// Unmarshal the JSON response into a Marine struct
@@ -526,6 +845,10 @@ func marine(ctx context.Context, query string, lang string, days int, date strin
 		return Marine{}, fmt.Errorf("unmarshalling response body: %v", err)
 	}
 
+	if marine.Location == nil || marine.Forecast == nil || marine.Forecast.ForecastDay == nil {
+		return Marine{}, apperr.New(apperr.UpstreamUnavailable, "weatherapi answered without marine forecast")
+	}
+
 	// Return the marine data
 	return marine, nil
 }
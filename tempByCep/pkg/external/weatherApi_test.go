@@ -2,12 +2,32 @@ package external
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/secret"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+// requireWeatherAPIKey pula os testes que batem na WeatherAPI de verdade quando não há chave.
+func requireWeatherAPIKey(t *testing.T) {
+	t.Helper()
+	if os.Getenv("WEATHER_API_KEY") == "" {
+		t.Skip("WEATHER_API_KEY is not set, skipping the live WeatherAPI test")
+	}
+}
+
 func TestDoRequest(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	method := "GET"
 	path := "current.json"
 	params := map[string]string{
@@ -16,7 +36,7 @@ func TestDoRequest(t *testing.T) {
 
 	resp, err := doRequest(context.Background(), method, path, params)
 	if err != nil {
-		t.Errorf("doRequest() returned an error: %v", err)
+		t.Fatalf("doRequest() returned an error: %v", err)
 	}
 
 	if resp.StatusCode != 200 {
@@ -25,8 +45,10 @@ func TestDoRequest(t *testing.T) {
 }
 
 func TestSearch(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	query := "mage-rio de janeiro-brazil"
-	expected := searchReturn{
+	expected := SearchResult{
 
 		Id:      279745,
 		Name:    "Mage",
@@ -37,23 +59,25 @@ func TestSearch(t *testing.T) {
 		Url:     "mage-rio-de-janeiro-brazil",
 	}
 
-	result, err := search(context.Background(), query)
+	results, err := SearchLocations(context.Background(), query)
 	if err != nil {
-		t.Errorf("search() returned an error: %v", err)
+		t.Errorf("SearchLocations() returned an error: %v", err)
 	}
 
-	if result != expected {
-		t.Errorf("search() returned unexpected result: got %v want %v", result, expected)
+	if len(results) == 0 || results[0] != expected {
+		t.Errorf("SearchLocations() returned unexpected result: got %v want %v", results, expected)
 	}
 }
 
 func TestCurrent(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	query := "mage-rio de janeiro-brazil"
 	lang := "pt"
 
 	result, err := CurrentWeather(context.Background(), query, lang)
 	if err != nil {
-		t.Errorf("Current() returned an error: %v", err)
+		t.Fatalf("Current() returned an error: %v", err)
 	}
 
 	if *result.Current == (Current{}) {
@@ -81,18 +105,20 @@ func TestCurrent(t *testing.T) {
 }
 
 func TestForecast(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	query := "mage-rio de janeiro-brazil"
 	lang := "pt"
 	days := 3
 
-	result, err := forecast(context.Background(), query, lang, days)
+	result, err := ForecastWeather(context.Background(), query, lang, days)
 	if err != nil {
-		t.Errorf("forecast() returned an error: %v", err)
+		t.Errorf("ForecastWeather() returned an error: %v", err)
 	}
 
 	// validar se o slice/array forecast day está presente e possui o mesmo tamanho de day
 	if len(*result.Forecast.ForecastDay) != 3 {
-		t.Errorf("forecast() returned an empty ForecastDay slice")
+		t.Errorf("ForecastWeather() returned an empty ForecastDay slice")
 	}
 
 	// Validar a existencia dos principais campos
@@ -105,15 +131,17 @@ func TestForecast(t *testing.T) {
 		for _, field := range fields {
 			val := dayVal.FieldByName(field)
 			if !val.IsValid() {
-				t.Errorf("forecast() did not return a ForecastDay struct with the field %s", field)
+				t.Errorf("ForecastWeather() did not return a ForecastDay struct with the field %s", field)
 			}
 		}
 	}
 }
 func TestIP(t *testing.T) {
-	ipaddress := "192.168.1.1"
+	requireWeatherAPIKey(t)
 
-	result, err := ip(context.Background(), ipaddress)
+	ipaddress := "8.8.8.8"
+
+	result, err := LookupIP(context.Background(), ipaddress)
 	if err != nil {
 		t.Errorf("ip() returned an error: %v", err)
 	}
@@ -137,31 +165,33 @@ func TestIP(t *testing.T) {
 	}
 }
 func TestFuture(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	code := "mage-rio de janeiro-brazil"
 	lang := "pt"
 
 	date := time.Now().Format("2006-01-02") // error test
 
-	_, err := future(context.Background(), code, lang, date)
+	_, err := FutureWeather(context.Background(), code, lang, date)
 	if err == nil {
-		t.Errorf("future() did not return an error for an invalid date")
+		t.Errorf("FutureWeather() did not return an error for an invalid date")
 	}
 
 	//valid test
 	date = time.Now().AddDate(0, 0, 20).Format("2006-01-02")
 
-	result, err := future(context.Background(), code, lang, date)
+	result, err := FutureWeather(context.Background(), code, lang, date)
 	if err != nil {
-		t.Errorf("future() returned an error: %v", err)
+		t.Errorf("FutureWeather() returned an error: %v", err)
 	}
 
 	// Check if the fields are present
 	if *result.Location == (Location{}) {
-		t.Errorf("future() returned an empty Location struct")
+		t.Errorf("FutureWeather() returned an empty Location struct")
 	}
 
 	if *result.Forecast == (ForecastBase{}) {
-		t.Errorf("future() returned an empty ForecastBase struct")
+		t.Errorf("FutureWeather() returned an empty ForecastBase struct")
 	}
 
 	// Check if the specific fields in the Forecast struct are present
@@ -173,40 +203,44 @@ func TestFuture(t *testing.T) {
 	for _, field := range fields {
 		val := forecastVal.FieldByName(field)
 		if !val.IsValid() {
-			t.Errorf("future() did not return a Forecast struct with the field %s", field)
+			t.Errorf("FutureWeather() did not return a Forecast struct with the field %s", field)
 		}
 	}
 }
 
 func TestTimezone(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	code := "mage-rio de janeiro-brazil"
 
-	result, err := timezone(context.Background(), code)
+	result, err := LocationTimeZone(context.Background(), code)
 	if err != nil {
-		t.Errorf("timezone() returned an error: %v", err)
+		t.Errorf("LocationTimeZone() returned an error: %v", err)
 	}
 
 	if result == (TimeZone{}) {
-		t.Errorf("timezone() returned an empty TimeZone struct")
+		t.Errorf("LocationTimeZone() returned an empty TimeZone struct")
 	}
 }
 
 func TestAstronomy(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	query := "mage-rio de janeiro-brazil"
 	date := "2024-01-01" // This date should be on or after 1st Jan, 2015
 
-	result, err := astronomy(context.Background(), query, date)
+	result, err := AstronomyWeather(context.Background(), query, date)
 	if err != nil {
-		t.Errorf("astronomy() returned an error: %v", err)
+		t.Errorf("AstronomyWeather() returned an error: %v", err)
 	}
 
 	// Check if the fields are present
 	if *result.Location == (Location{}) {
-		t.Errorf("astronomy() returned an empty Location struct")
+		t.Errorf("AstronomyWeather() returned an empty Location struct")
 	}
 
 	if *result.Astronomy == (AstronomyBase{}) {
-		t.Errorf("astronomy() returned an empty AstronomyBase struct")
+		t.Errorf("AstronomyWeather() returned an empty AstronomyBase struct")
 	}
 
 	// Check if the specific fields in the Astronomy struct are present
@@ -218,27 +252,29 @@ func TestAstronomy(t *testing.T) {
 	for _, field := range fields {
 		val := astronomyVal.FieldByName(field)
 		if !val.IsValid() {
-			t.Errorf("astronomy() did not return an Astronomy struct with the field %s", field)
+			t.Errorf("AstronomyWeather() did not return an Astronomy struct with the field %s", field)
 		}
 	}
 }
 
 func TestMarine(t *testing.T) {
+	requireWeatherAPIKey(t)
+
 	query := "rio de janeiro - rio de janeiro - brazil"
 	days := 1
 
-	result, err := marine(context.Background(), query, "pt", days, "", 0, 0)
+	result, err := MarineWeather(context.Background(), query, "pt", days, "", 0, 0)
 	if err != nil {
-		t.Errorf("marine() returned an error: %v", err)
+		t.Errorf("MarineWeather() returned an error: %v", err)
 	}
 
 	// Check if the fields are present
 	if *result.Location == (Location{}) {
-		t.Errorf("marine() returned an empty Location struct")
+		t.Errorf("MarineWeather() returned an empty Location struct")
 	}
 
-	if *result.Forecast == (ForecastBase{}) {
-		t.Errorf("marine() returned an empty Forecast struct")
+	if *result.Forecast == (MarineForecastBase{}) {
+		t.Errorf("MarineWeather() returned an empty Forecast struct")
 	}
 
 	if len(*result.Forecast.ForecastDay) != 1 {
@@ -253,7 +289,244 @@ func TestMarine(t *testing.T) {
 	for _, field := range fields {
 		val := marineVal.FieldByName(field)
 		if !val.IsValid() {
-			t.Errorf("marine() did not return a Marine struct with the field %s", field)
+			t.Errorf("MarineWeather() did not return a Marine struct with the field %s", field)
+		}
+	}
+}
+
+// withFakeWeatherApi aponta o client para um servidor de teste.
+func withFakeWeatherApi(t *testing.T, handler http.HandlerFunc, timeout time.Duration) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previousUrl, previousKey, previousTimeout := baseUrl, apiKeySource, weatherRequestExpirationTime
+	baseUrl, apiKeySource, weatherRequestExpirationTime = server.URL, secret.Static("test-key"), timeout
+	t.Cleanup(func() {
+		server.Close()
+		baseUrl, apiKeySource, weatherRequestExpirationTime = previousUrl, previousKey, previousTimeout
+	})
+}
+
+func TestDoRequestPropagatesTraceContext(t *testing.T) {
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	var traceparent, key string
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		key = r.URL.Query().Get("key")
+		w.Write([]byte(`{"location":{"name":"Mage"},"current":{"temp_c":25}}`))
+	}, time.Second)
+
+	result, err := CurrentWeather(context.Background(), "mage", "pt")
+	if err != nil {
+		t.Fatalf("CurrentWeather() returned an error: %v", err)
+	}
+	if result.Current.TempC != 25 {
+		t.Errorf("CurrentWeather() returned %v", result.Current.TempC)
+	}
+	if traceparent == "" {
+		t.Errorf("doRequest() did not inject the traceparent header")
+	}
+	if key != "test-key" {
+		t.Errorf("doRequest() sent the key %q", key)
+	}
+}
+
+func TestDoRequestTimeout(t *testing.T) {
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}, 50*time.Millisecond)
+
+	_, err := CurrentWeather(context.Background(), "mage", "pt")
+	var timeoutErr *RequestTimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CurrentWeather() returned %v, expected a RequestTimeoutError", err)
+	}
+}
+
+func TestDoRequestHonorsCancellation(t *testing.T) {
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := CurrentWeather(ctx, "mage", "pt")
+	var timeoutErr *RequestTimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("CurrentWeather() returned %v, expected a canceled RequestTimeoutError", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("CurrentWeather() ignored the cancellation")
+	}
+}
+
+func TestDoRequestWithoutAPIKey(t *testing.T) {
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("doRequest() called WeatherAPI without a key")
+	}, time.Second)
+	apiKeySource = secret.Static("")
+
+	_, err := CurrentWeather(context.Background(), "mage", "pt")
+	if !errors.Is(err, ErrMissingAPIKey) {
+		t.Errorf("CurrentWeather() returned %v, expected %v", err, ErrMissingAPIKey)
+	}
+}
+
+func TestDoRequestClassifiesErrorAnswers(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		kind   *apperr.Kind
+	}{
+		{http.StatusBadRequest, `{"error":{"code":1006,"message":"No matching location found."}}`, apperr.NotFound},
+		{http.StatusForbidden, `{"error":{"code":2008,"message":"API key has been disabled."}}`, apperr.Misconfigured},
+		{http.StatusForbidden, `{"error":{"code":2007,"message":"API key has exceeded calls per month quota."}}`, apperr.RateLimited},
+		{http.StatusInternalServerError, `{"error":{"code":9999,"message":"Internal application error."}}`, apperr.UpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}, time.Second)
+
+		_, err := CurrentWeather(context.Background(), "nowhere", "pt")
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("CurrentWeather() returned %v for %s, expected %v", err, tt.body, tt.kind)
+		}
+	}
+}
+
+func TestForecastWeatherValidatesDays(t *testing.T) {
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("ForecastWeather() called WeatherAPI with an invalid range")
+	}, time.Second)
+
+	for _, days := range []int{0, ForecastMaxDays + 1} {
+		_, err := ForecastWeather(context.Background(), "mage", "pt", days)
+		if !errors.Is(err, apperr.InvalidInput) {
+			t.Errorf("ForecastWeather() returned %v for %d days, expected %v", err, days, apperr.InvalidInput)
+		}
+	}
+}
+
+func TestSearchLocationsReturnsEveryMatch(t *testing.T) {
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("q") {
+		case "bom jesus":
+			w.Write([]byte(`[{"id":1,"name":"Bom Jesus","region":"Piaui","country":"Brazil","url":"bom-jesus-piaui-brazil"},` +
+				`{"id":2,"name":"Bom Jesus","region":"Rio Grande do Sul","country":"Brazil","url":"bom-jesus-rio-grande-do-sul-brazil"}]`))
+		case "broken":
+			w.Write([]byte(`{"unexpected":true}`))
+		default:
+			w.Write([]byte(`[]`))
 		}
+	}, time.Second)
+
+	results, err := SearchLocations(context.Background(), "bom jesus")
+	if err != nil || len(results) != 2 || results[1].Region != "Rio Grande do Sul" {
+		t.Errorf("SearchLocations() returned %v, %v", results, err)
+	}
+
+	results, err = SearchLocations(context.Background(), "nowhere")
+	if err != nil || results == nil || len(results) != 0 {
+		t.Errorf("SearchLocations() returned %v, %v without matches, expected an empty slice", results, err)
+	}
+
+	_, err = SearchLocations(context.Background(), "broken")
+	if !errors.Is(err, apperr.UpstreamUnavailable) {
+		t.Errorf("SearchLocations() returned %v for an invalid answer, expected %v", err, apperr.UpstreamUnavailable)
+	}
+}
+
+func TestLookupIPValidatesAddress(t *testing.T) {
+	var queries []string
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q"))
+		w.Write([]byte(`{"ip":"` + r.URL.Query().Get("q") + `","city":"Mountain View","lat":37.41,"lon":-122.08}`))
+	}, time.Second)
+
+	for _, address := range []string{"8.8.8.8", "::ffff:8.8.4.4", "2001:4860:4860::8888"} {
+		result, err := LookupIP(context.Background(), address)
+		if err != nil || result.City != "Mountain View" {
+			t.Errorf("LookupIP() returned %+v, %v for %s", result, err, address)
+		}
+	}
+	expected := []string{"8.8.8.8", "8.8.4.4", "2001:4860:4860::8888"}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("LookupIP() asked WeatherAPI for %v, expected %v", queries, expected)
+	}
+
+	queries = nil
+	for _, address := range []string{"", "19216811", "1.2.3", "192.168.1.1", "10.0.0.1", "127.0.0.1", "::1", "fe80::1", "fd00::1", "0.0.0.0", "224.0.0.1"} {
+		_, err := LookupIP(context.Background(), address)
+		if !errors.Is(err, apperr.InvalidInput) {
+			t.Errorf("LookupIP() returned %v for %q, expected %v", err, address, apperr.InvalidInput)
+		}
+	}
+	if len(queries) != 0 {
+		t.Errorf("LookupIP() asked WeatherAPI for %v, expected no request", queries)
+	}
+}
+
+func TestFutureWeatherWindowUsesLocationDate(t *testing.T) {
+	var forecastCalls int
+	withFakeWeatherApi(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/timezone.json":
+			// 23:30 em Manaus já é o dia seguinte em UTC
+			w.Write([]byte(`{"location":{"name":"Manaus","tz_id":"America/Manaus","localtime":"2024-05-01 23:30"}}`))
+		case "/forecast.json":
+			forecastCalls++
+			w.Write([]byte(`{"location":{"name":"Manaus"},"forecast":{"forecastday":[{"date":"` + r.URL.Query().Get("dt") + `"}]}}`))
+		}
+	}, time.Second)
+
+	tests := []struct {
+		date string
+		kind *apperr.Kind
+	}{
+		{"2024-05-15", nil},
+		{"2024-05-14", apperr.InvalidInput},
+		{"2025-02-25", nil},
+		{"2025-02-26", apperr.InvalidInput},
+		{"15/05/2024", apperr.InvalidInput},
+	}
+	for _, tt := range tests {
+		result, err := FutureWeather(context.Background(), "manaus", "pt", tt.date)
+		if tt.kind == nil {
+			if err != nil || (*result.Forecast.ForecastDay)[0].Date != tt.date {
+				t.Errorf("FutureWeather() returned %v for %s", err, tt.date)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("FutureWeather() returned %v for %s, expected %v", err, tt.date, tt.kind)
+		}
+	}
+	if forecastCalls != 2 {
+		t.Errorf("FutureWeather() asked WeatherAPI %d times for the forecast, expected 2", forecastCalls)
+	}
+}
+
+func TestLocationZoneFallsBackToLocaltimeOffset(t *testing.T) {
+	// 2024-05-01 12:00 UTC, três horas antes no horário local
+	zone, err := LocationZone(&Location{TzID: "Nowhere/Unknown", Localtime: "2024-05-01 9:00", LocaltimeEpoch: 1714564800})
+	if err != nil {
+		t.Fatalf("LocationZone() returned an error: %v", err)
+	}
+	_, offset := time.Date(2024, 5, 1, 0, 0, 0, 0, zone).Zone()
+	if offset != -3*60*60 {
+		t.Errorf("LocationZone() returned the offset %d", offset)
 	}
 }
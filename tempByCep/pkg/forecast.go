@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// forecastDefaultDays é usado quando o days não é informado
+const forecastDefaultDays = 3
+
+// forecastWeather é trocado nos testes
+var forecastWeather = external.ForecastWeather
+
+type Temperature struct {
+	C float32 `json:"c"`
+	F float32 `json:"f"`
+	K float32 `json:"k"`
+}
+
+func newTemperature(celsius float32, fahrenheit float32) Temperature {
+	return Temperature{C: celsius, F: fahrenheit, K: kelvin(celsius)}
+}
+
+type ForecastResponse struct {
+	City string               `json:"city"`
+	Days []ForecastDaySummary `json:"days"`
+}
+
+// ForecastDaySummary is the trimmed forecast of one day, Hours is only filled when asked with hourly=true.
+type ForecastDaySummary struct {
+	Date         string                `json:"date"`
+	Min          Temperature           `json:"min"`
+	Max          Temperature           `json:"max"`
+	Avg          Temperature           `json:"avg"`
+	ChanceOfRain float32               `json:"chance_of_rain"`
+	Condition    string                `json:"condition"`
+	Hours        []ForecastHourSummary `json:"hours,omitempty"`
+}
+
+type ForecastHourSummary struct {
+	Time         string      `json:"time"`
+	Temp         Temperature `json:"temp"`
+	ChanceOfRain float32     `json:"chance_of_rain"`
+	Condition    string      `json:"condition"`
+}
+
+// forecastHandler devolve a previsão da cidade do CEP: GET /forecast/{cep}?days=N&hourly=true
+func forecastHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("forecast").Start(ctx, "forecastHandler")
+	defer span.End()
+
+	cep, err := pathCep(r, "/forecast/")
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	days, hourly, err := readForecastQuery(r)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("cep", cep),
+		attribute.Int("forecast.days", days),
+		attribute.Bool("forecast.hourly", hourly),
+	)
+
+	forecast, err := resolveForecast(ctx, cep, days, hourly)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(forecast)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// readForecastQuery lê e valida days e hourly, os dois opcionais.
+func readForecastQuery(r *http.Request) (int, bool, error) {
+	query := r.URL.Query()
+	days, err := readDays(query, forecastDefaultDays, external.ForecastMaxDays)
+	if err != nil {
+		return 0, false, err
+	}
+
+	hourly, err := readHourly(query)
+	if err != nil {
+		return 0, false, err
+	}
+	return days, hourly, nil
+}
+
+// readDays lê o days opcional, entre 1 e max.
+func readDays(query url.Values, def int, max int) (int, error) {
+	days := def
+	if raw := query.Get("days"); raw != "" {
+		var err error
+		days, err = strconv.Atoi(raw)
+		if err != nil {
+			return 0, apperr.Wrap(apperr.InvalidInput, err, "days must be a number")
+		}
+	}
+	if days < 1 || days > max {
+		return 0, apperr.New(apperr.InvalidInput, fmt.Sprintf("days should be between 1 and %d", max))
+	}
+	return days, nil
+}
+
+// readHourly lê o hourly opcional, que pede as horas de cada dia da previsão.
+func readHourly(query url.Values) (bool, error) {
+	raw := query.Get("hourly")
+	if raw == "" {
+		return false, nil
+	}
+	hourly, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, apperr.Wrap(apperr.InvalidInput, err, "hourly must be true or false")
+	}
+	return hourly, nil
+}
+
+// resolveForecast busca o endereço do CEP e a previsão da cidade.
+func resolveForecast(ctx context.Context, cep string, days int, hourly bool) (ForecastResponse, error) {
+	c, err := CachedCepConcurrency(ctx, cep)
+	if err != nil {
+		return ForecastResponse{}, err
+	}
+
+	forecast, err := forecastWeather(ctx, weatherQuery(ctx, c), "pt", days)
+	if err != nil {
+		return ForecastResponse{}, err
+	}
+	return summarizeForecast(forecast, hourly), nil
+}
+
+func summarizeForecast(forecast external.Forecast, hourly bool) ForecastResponse {
+	response := ForecastResponse{City: forecast.Location.Name, Days: []ForecastDaySummary{}}
+	for _, forecastDay := range *forecast.Forecast.ForecastDay {
+		if forecastDay.Day == nil {
+			continue
+		}
+		day := forecastDay.Day
+		summary := ForecastDaySummary{
+			Date:         forecastDay.Date,
+			Min:          newTemperature(day.MintempC, day.MintempF),
+			Max:          newTemperature(day.MaxtempC, day.MaxtempF),
+			Avg:          newTemperature(day.AvgtempC, day.AvgtempF),
+			ChanceOfRain: day.DailyChanceOfRain,
+			Condition:    conditionText(day.Condition),
+		}
+		if hourly && forecastDay.Hour != nil {
+			for _, hour := range *forecastDay.Hour {
+				summary.Hours = append(summary.Hours, ForecastHourSummary{
+					Time:         hour.Time,
+					Temp:         newTemperature(hour.TempC, hour.TempF),
+					ChanceOfRain: hour.ChanceOfRain,
+					Condition:    conditionText(hour.Condition),
+				})
+			}
+		}
+		response.Days = append(response.Days, summary)
+	}
+	return response
+}
+
+func conditionText(condition *external.Condition) string {
+	if condition == nil {
+		return ""
+	}
+	return condition.Text
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+// withFakeForecast troca a consulta de previsão da WeatherAPI durante o teste.
+func withFakeForecast(t *testing.T, fetch func(ctx context.Context, query string, lang string, days int) (external.Forecast, error)) {
+	t.Helper()
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "20541155", City: "Rio de Janeiro", State: "RJ"}})
+	previous := forecastWeather
+	forecastWeather = fetch
+	t.Cleanup(func() { forecastWeather = previous })
+}
+
+func fakeForecast(days int) external.Forecast {
+	forecastDays := make([]external.ForecastDay, days)
+	for i := range forecastDays {
+		forecastDays[i] = external.ForecastDay{
+			Date: "2024-05-0" + string(rune('1'+i)),
+			Day: &external.Day{
+				MintempC: 18, MintempF: 64.4,
+				MaxtempC: 30, MaxtempF: 86,
+				AvgtempC: 24, AvgtempF: 75.2,
+				DailyChanceOfRain: 80,
+				Condition:         &external.Condition{Text: "Chuva moderada"},
+			},
+			Hour: &[]external.Hour{{Time: "2024-05-01 00:00", TempC: 20, TempF: 68, ChanceOfRain: 10}},
+		}
+	}
+	return external.Forecast{
+		Location: &external.Location{Name: "Rio de Janeiro"},
+		Forecast: &external.ForecastBase{ForecastDay: &forecastDays},
+	}
+}
+
+func getForecast(target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	forecastHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func TestForecastHandlerSummarizesDays(t *testing.T) {
+	var query string
+	var requestedDays int
+	withFakeForecast(t, func(ctx context.Context, q string, lang string, days int) (external.Forecast, error) {
+		query, requestedDays = q, days
+		return fakeForecast(days), nil
+	})
+
+	recorder := getForecast("/forecast/20541-155?days=2")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("forecastHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if query != "Rio de Janeiro-RJ-brazil" || requestedDays != 2 {
+		t.Errorf("forecastHandler() asked WeatherAPI for %q in %d days", query, requestedDays)
+	}
+
+	var response ForecastResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("forecastHandler() answered an invalid body: %v", err)
+	}
+	if response.City != "Rio de Janeiro" || len(response.Days) != 2 {
+		t.Fatalf("forecastHandler() answered %+v", response)
+	}
+	day := response.Days[0]
+	if day.Min != (Temperature{C: 18, F: 64.4, K: 291}) || day.Max.K != 303 || day.Avg.C != 24 {
+		t.Errorf("forecastHandler() answered the temperatures %+v", day)
+	}
+	if day.ChanceOfRain != 80 || day.Condition != "Chuva moderada" {
+		t.Errorf("forecastHandler() answered %+v", day)
+	}
+	if day.Hours != nil {
+		t.Errorf("forecastHandler() answered the hours without hourly=true")
+	}
+}
+
+func TestForecastHandlerHourly(t *testing.T) {
+	withFakeForecast(t, func(ctx context.Context, q string, lang string, days int) (external.Forecast, error) {
+		return fakeForecast(days), nil
+	})
+
+	recorder := getForecast("/forecast/20541155?hourly=true")
+	var response ForecastResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("forecastHandler() answered an invalid body: %v", err)
+	}
+	if len(response.Days) != forecastDefaultDays {
+		t.Fatalf("forecastHandler() answered %d days, expected %d", len(response.Days), forecastDefaultDays)
+	}
+	hours := response.Days[0].Hours
+	if len(hours) != 1 || hours[0].Temp.K != 293 || hours[0].ChanceOfRain != 10 {
+		t.Errorf("forecastHandler() answered the hours %+v", hours)
+	}
+}
+
+func TestForecastHandlerRejectsQuery(t *testing.T) {
+	withFakeForecast(t, func(ctx context.Context, q string, lang string, days int) (external.Forecast, error) {
+		t.Errorf("forecastHandler() called WeatherAPI for an invalid request")
+		return external.Forecast{}, nil
+	})
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/forecast/20541155?days=0", http.StatusUnprocessableEntity},
+		{"/forecast/20541155?days=15", http.StatusUnprocessableEntity},
+		{"/forecast/20541155?days=two", http.StatusUnprocessableEntity},
+		{"/forecast/20541155?hourly=maybe", http.StatusUnprocessableEntity},
+		{"/forecast/123", http.StatusUnprocessableEntity},
+		{"/forecast/", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		recorder := getForecast(tt.target)
+		if recorder.Code != tt.status {
+			t.Errorf("forecastHandler() answered %d for %s, expected %d", recorder.Code, tt.target, tt.status)
+		}
+	}
+}
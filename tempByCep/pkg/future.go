@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// futureWeather é trocado nos testes
+var futureWeather = external.FutureWeather
+
+// futureHandler devolve o tempo projetado para uma data da cidade do CEP: GET /future/{cep}?date=YYYY-MM-DD
+func futureHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("forecast").Start(ctx, "futureHandler")
+	defer span.End()
+
+	cep, err := pathCep(r, "/future/")
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	date, err := readDate(r)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	hourly, err := readHourly(r.URL.Query())
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("cep", cep),
+		attribute.String("future.date", date),
+		attribute.Bool("forecast.hourly", hourly),
+	)
+
+	future, err := resolveFuture(ctx, cep, date, hourly)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(future)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// readDate lê o date obrigatório, a janela de dias só é conferida com o fuso da cidade.
+func readDate(r *http.Request) (string, error) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		return "", apperr.New(apperr.InvalidInput, "date is required")
+	}
+	_, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", apperr.Wrap(apperr.InvalidInput, err, "date should be in the format YYYY-MM-DD")
+	}
+	return date, nil
+}
+
+// resolveFuture busca o endereço do CEP e o tempo projetado da cidade para date.
+func resolveFuture(ctx context.Context, cep string, date string, hourly bool) (ForecastResponse, error) {
+	c, err := CachedCepConcurrency(ctx, cep)
+	if err != nil {
+		return ForecastResponse{}, err
+	}
+
+	future, err := futureWeather(ctx, weatherQuery(ctx, c), "pt", date)
+	if err != nil {
+		return ForecastResponse{}, err
+	}
+	return summarizeForecast(future, hourly), nil
+}
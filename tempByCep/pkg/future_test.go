@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+// withFakeFuture troca a consulta de tempo projetado da WeatherAPI durante o teste.
+func withFakeFuture(t *testing.T, fetch func(ctx context.Context, query string, lang string, date string) (external.Forecast, error)) {
+	t.Helper()
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "20541155", City: "Rio de Janeiro", State: "RJ"}})
+	previous := futureWeather
+	futureWeather = fetch
+	t.Cleanup(func() { futureWeather = previous })
+}
+
+func TestFutureHandlerSummarizesDate(t *testing.T) {
+	var requested string
+	withFakeFuture(t, func(ctx context.Context, query string, lang string, date string) (external.Forecast, error) {
+		requested = date
+		return fakeForecast(1), nil
+	})
+
+	recorder := getFuture("/future/20541-155?date=2024-06-01")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("futureHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if requested != "2024-06-01" {
+		t.Errorf("futureHandler() asked WeatherAPI for %q", requested)
+	}
+	var response ForecastResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("futureHandler() answered an invalid body: %v", err)
+	}
+	if response.City != "Rio de Janeiro" || len(response.Days) != 1 || response.Days[0].Max.C != 30 {
+		t.Errorf("futureHandler() answered %+v", response)
+	}
+}
+
+func TestFutureHandlerRejectsDate(t *testing.T) {
+	withFakeFuture(t, func(ctx context.Context, query string, lang string, date string) (external.Forecast, error) {
+		// a janela de dias é conferida pelo client, com o fuso da cidade
+		return external.Forecast{}, apperr.New(apperr.InvalidInput, "date should be between 14 and 300 days from today")
+	})
+
+	for _, target := range []string{"/future/20541155", "/future/20541155?date=01-06-2024", "/future/20541155?date=2024-05-02"} {
+		recorder := getFuture(target)
+		if recorder.Code != http.StatusUnprocessableEntity {
+			t.Errorf("futureHandler() answered %d for %s, expected %d", recorder.Code, target, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func getFuture(target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	futureHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
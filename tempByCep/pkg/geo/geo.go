@@ -0,0 +1,88 @@
+package geo
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// raio médio da Terra usado pelo haversine
+const earthRadiusKm = 6371.0
+
+type Point struct {
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+	Name string  `json:"name,omitempty"`
+}
+
+// Distance is the great-circle distance between a and b in kilometers (haversine).
+func Distance(a Point, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := radians(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+//go:embed coastline.csv
+var coastlineCSV string
+
+// coastline é carregado uma vez do csv embutido
+var coastline = mustParsePoints(coastlineCSV)
+
+// Coastline returns points along the Brazilian coast, from north to south.
+func Coastline() []Point {
+	return append([]Point(nil), coastline...)
+}
+
+// NearestCoast returns the coastline point closest to p and its distance in kilometers.
+// The coast is sampled every few dozen kilometers, so this is an approximation of the real distance.
+func NearestCoast(p Point) (Point, float64) {
+	nearest, distance := Point{}, math.Inf(1)
+	for _, c := range coastline {
+		d := Distance(p, c)
+		if d < distance {
+			nearest, distance = c, d
+		}
+	}
+	return nearest, distance
+}
+
+// parsePoints lê linhas "lat,lon,nome", ignorando vazias e comentários (#)
+func parsePoints(csv string) ([]Point, error) {
+	var points []Point
+	for n, line := range strings.Split(csv, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ",", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected lat,lon,name", n+1)
+		}
+		lat, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		lon, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		points = append(points, Point{Lat: lat, Lon: lon, Name: fields[2]})
+	}
+	return points, nil
+}
+
+func mustParsePoints(csv string) []Point {
+	points, err := parsePoints(csv)
+	if err != nil {
+		panic("geo: invalid coastline: " + err.Error())
+	}
+	return points
+}
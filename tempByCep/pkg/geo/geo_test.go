@@ -0,0 +1,60 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	rio := Point{Lat: -22.97, Lon: -43.18}
+	saoPaulo := Point{Lat: -23.55, Lon: -46.63}
+
+	d := Distance(rio, saoPaulo)
+	// ~357 km em linha reta
+	if math.Abs(d-357) > 5 {
+		t.Errorf("Distance() returned %.1f km", d)
+	}
+	if Distance(rio, rio) != 0 {
+		t.Errorf("Distance() of a point to itself is not zero")
+	}
+}
+
+func TestNearestCoast(t *testing.T) {
+	tests := []struct {
+		name   string
+		point  Point
+		within float64
+		beyond float64
+	}{
+		{"Copacabana", Point{Lat: -22.97, Lon: -43.19}, 5, 0},
+		{"Maceió", Point{Lat: -9.65, Lon: -35.73}, 10, 0},
+		{"São Paulo", Point{Lat: -23.55, Lon: -46.63}, math.Inf(1), 40},
+		{"Brasília", Point{Lat: -15.79, Lon: -47.88}, math.Inf(1), 800},
+	}
+	for _, tt := range tests {
+		_, d := NearestCoast(tt.point)
+		if d > tt.within || d < tt.beyond {
+			t.Errorf("NearestCoast(%s) is %.1f km away", tt.name, d)
+		}
+	}
+}
+
+func TestCoastlineIsDense(t *testing.T) {
+	points := Coastline()
+	if len(points) < 100 {
+		t.Fatalf("Coastline() has only %d points", len(points))
+	}
+	// sem buracos grandes, senão uma cidade no litoral entre dois pontos parece estar longe do mar
+	for i := 1; i < len(points); i++ {
+		if d := Distance(points[i-1], points[i]); d > 150 {
+			t.Errorf("%s and %s are %.0f km apart", points[i-1].Name, points[i].Name, d)
+		}
+	}
+}
+
+func TestParsePointsRejectsInvalidLine(t *testing.T) {
+	_, err := parsePoints("# comentário\n-22.97,-43.18,Rio\n-22.97;-43.18\n")
+	if err == nil {
+		t.Errorf("parsePoints() accepted an invalid line")
+	}
+}
@@ -17,7 +17,7 @@ import (
 
 // New bootstraps the OpenTelemetry pipeline.
 // If it does not return an error, make sure to call shutdown for proper cleanup.
-func SetupProvider(ctx context.Context, serviceName string) (shutdown func(context.Context) error, err error) {
+func SetupProvider(ctx context.Context, serviceName string, collectorAddr string) (shutdown func(context.Context) error, err error) {
 	var shutdownFuncs []func(context.Context) error
 
 	// shutdown calls cleanup functions registered via shutdownFuncs.
@@ -43,7 +43,7 @@ func SetupProvider(ctx context.Context, serviceName string) (shutdown func(conte
 		),
 	)
 
-	grpcConn, err := grpc.NewClient("otel-collector:4317",
+	grpcConn, err := grpc.NewClient(collectorAddr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
 
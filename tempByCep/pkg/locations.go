@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// searchLocations é trocado nos testes
+var searchLocations = external.SearchLocations
+
+const (
+	// locationsDefaultCountry é o country da WeatherAPI, sempre em inglês
+	locationsDefaultCountry = "Brazil"
+	// locationsAnyCountry desliga o filtro
+	locationsAnyCountry = "all"
+)
+
+// LocationsResponse lists the WeatherAPI matches of Query, Country is the filter applied ("all" for none).
+type LocationsResponse struct {
+	Query     string                  `json:"query"`
+	Country   string                  `json:"country"`
+	Locations []external.SearchResult `json:"locations"`
+}
+
+// locationsHandler lista as cidades que batem com o nome, para desambiguar homônimas: GET /locations?q=..&country=..
+func locationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("temp").Start(ctx, "locationsHandler")
+	defer span.End()
+
+	q, country, err := readLocationsQuery(r.URL.Query())
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.String("locations.query", q), attribute.String("locations.country", country))
+
+	locations, err := resolveLocations(ctx, q, country)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(locations)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// readLocationsQuery lê o q obrigatório e o country opcional, Brasil por padrão.
+func readLocationsQuery(query url.Values) (string, string, error) {
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		return "", "", apperr.New(apperr.InvalidInput, "q is required")
+	}
+	country := strings.TrimSpace(query.Get("country"))
+	if country == "" {
+		country = locationsDefaultCountry
+	}
+	return q, country, nil
+}
+
+// resolveLocations busca na WeatherAPI e mantém só as cidades do país pedido.
+func resolveLocations(ctx context.Context, q string, country string) (LocationsResponse, error) {
+	results, err := searchLocations(ctx, q)
+	if err != nil {
+		return LocationsResponse{}, err
+	}
+
+	response := LocationsResponse{Query: q, Country: country, Locations: []external.SearchResult{}}
+	for _, result := range results {
+		if strings.EqualFold(country, locationsAnyCountry) || strings.EqualFold(result.Country, country) {
+			response.Locations = append(response.Locations, result)
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("locations.matches", len(results)),
+		attribute.Int("locations.count", len(response.Locations)),
+	)
+	return response, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+// withFakeSearch troca a busca de cidades da WeatherAPI durante o teste.
+func withFakeSearch(t *testing.T, search func(ctx context.Context, q string) ([]external.SearchResult, error)) {
+	t.Helper()
+	previous := searchLocations
+	searchLocations = search
+	t.Cleanup(func() { searchLocations = previous })
+}
+
+func getLocations(target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	locationsHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func fakeSearch(ctx context.Context, q string) ([]external.SearchResult, error) {
+	return []external.SearchResult{
+		{Id: 1, Name: "Bom Jesus", Region: "Piaui", Country: "Brazil", Url: "bom-jesus-piaui-brazil"},
+		{Id: 2, Name: "Bom Jesus", Region: "Rio Grande do Sul", Country: "Brazil", Url: "bom-jesus-rio-grande-do-sul-brazil"},
+		{Id: 3, Name: "Bom Jesus", Region: "Luanda", Country: "Angola", Url: "bom-jesus-luanda-angola"},
+	}, nil
+}
+
+func TestLocationsHandlerFiltersCountry(t *testing.T) {
+	var searched string
+	withFakeSearch(t, func(ctx context.Context, q string) ([]external.SearchResult, error) {
+		searched = q
+		return fakeSearch(ctx, q)
+	})
+
+	tests := []struct {
+		target  string
+		country string
+		regions []string
+	}{
+		{"/locations?q=bom+jesus", "Brazil", []string{"Piaui", "Rio Grande do Sul"}},
+		{"/locations?q=bom+jesus&country=angola", "angola", []string{"Luanda"}},
+		{"/locations?q=bom+jesus&country=all", "all", []string{"Piaui", "Rio Grande do Sul", "Luanda"}},
+		{"/locations?q=bom+jesus&country=Chile", "Chile", []string{}},
+	}
+	for _, tt := range tests {
+		recorder := getLocations(tt.target)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("locationsHandler() answered %d for %s: %s", recorder.Code, tt.target, recorder.Body)
+		}
+		var response LocationsResponse
+		err := json.Unmarshal(recorder.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("locationsHandler() answered an invalid body: %v", err)
+		}
+		if searched != "bom jesus" || response.Query != "bom jesus" || response.Country != tt.country {
+			t.Errorf("locationsHandler() searched %q and answered %+v for %s", searched, response, tt.target)
+		}
+		if response.Locations == nil || len(response.Locations) != len(tt.regions) {
+			t.Errorf("locationsHandler() answered %v for %s, expected %v", response.Locations, tt.target, tt.regions)
+			continue
+		}
+		for i, region := range tt.regions {
+			if response.Locations[i].Region != region {
+				t.Errorf("locationsHandler() answered %v for %s, expected %v", response.Locations, tt.target, tt.regions)
+			}
+		}
+	}
+}
+
+func TestLocationsHandlerErrors(t *testing.T) {
+	withFakeSearch(t, func(ctx context.Context, q string) ([]external.SearchResult, error) {
+		return nil, apperr.New(apperr.RateLimited, "weatherapi quota exceeded")
+	})
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/locations", http.StatusUnprocessableEntity},
+		{"/locations?q=++", http.StatusUnprocessableEntity},
+		{"/locations?q=mage", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		recorder := getLocations(tt.target)
+		if recorder.Code != tt.status {
+			t.Errorf("locationsHandler() answered %d for %s, expected %d", recorder.Code, tt.target, tt.status)
+		}
+	}
+}
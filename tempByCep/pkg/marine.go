@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/geo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// marineWeather é trocado nos testes
+var marineWeather = external.MarineWeather
+
+// marineCoastDistanceKm é até onde uma cidade ainda é considerada litorânea
+var marineCoastDistanceKm = 30.0
+
+type MarineResponse struct {
+	City            string             `json:"city"`
+	CoastDistanceKm float64            `json:"coast_distance_km"`
+	Days            []MarineDaySummary `json:"days"`
+}
+
+type MarineDaySummary struct {
+	Date  string              `json:"date"`
+	Tides []TideSummary       `json:"tides"`
+	Hours []MarineHourSummary `json:"hours"`
+}
+
+type TideSummary struct {
+	Time    string  `json:"time"`
+	HeightM float64 `json:"height_m"`
+	Type    string  `json:"type"`
+}
+
+type MarineHourSummary struct {
+	Time           string  `json:"time"`
+	WaveHeightM    float32 `json:"wave_height_m"`
+	SwellHeightM   float32 `json:"swell_height_m"`
+	SwellDirection string  `json:"swell_direction"`
+	SwellPeriodS   float32 `json:"swell_period_s"`
+	WaterTempC     float32 `json:"water_temp_c"`
+}
+
+// marineHandler devolve marés e ondas da cidade do CEP, só para o litoral: GET /marine/{cep}?days=N
+func marineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("forecast").Start(ctx, "marineHandler")
+	defer span.End()
+
+	cep, err := pathCep(r, "/marine/")
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	days, err := readDays(r.URL.Query(), 1, external.MarineMaxDays)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.String("cep", cep), attribute.Int("marine.days", days))
+
+	marine, err := resolveMarine(ctx, cep, days)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(marine)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// resolveMarine busca o endereço do CEP, confere se a cidade fica no litoral e só então pede as marés.
+func resolveMarine(ctx context.Context, cep string, days int) (MarineResponse, error) {
+	c, err := CachedCepConcurrency(ctx, cep)
+	if err != nil {
+		return MarineResponse{}, err
+	}
+	query := weatherQuery(ctx, c)
+
+	// lat/lon da WeatherAPI, o tempo atual normalmente já está em cache
+	current, err := CachedCurrentWeather(ctx, query, "pt")
+	if err != nil {
+		return MarineResponse{}, err
+	}
+	city := geo.Point{Lat: float64(current.Location.Lat), Lon: float64(current.Location.Lon)}
+	coast, distance := geo.NearestCoast(city)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("marine.nearest_coast", coast.Name),
+		attribute.Float64("marine.coast_distance_km", distance),
+	)
+	if distance > marineCoastDistanceKm {
+		return MarineResponse{}, apperr.New(apperr.InvalidInput,
+			fmt.Sprintf("cep %s is inland, %s is %.0f km away from the coast", cep, current.Location.Name, distance))
+	}
+
+	marine, err := marineWeather(ctx, query, "pt", days, "", 0, 0)
+	if err != nil {
+		return MarineResponse{}, err
+	}
+	return summarizeMarine(marine, distance), nil
+}
+
+func summarizeMarine(marine external.Marine, distance float64) MarineResponse {
+	response := MarineResponse{City: marine.Location.Name, CoastDistanceKm: distance, Days: []MarineDaySummary{}}
+	for _, forecastDay := range *marine.Forecast.ForecastDay {
+		day := MarineDaySummary{Date: forecastDay.Date, Tides: []TideSummary{}, Hours: []MarineHourSummary{}}
+		if forecastDay.Day != nil && forecastDay.Day.Tides != nil {
+			for _, tides := range *forecastDay.Day.Tides {
+				if tides.Tide == nil {
+					continue
+				}
+				for _, tide := range *tides.Tide {
+					// altura inválida fica 0, a hora e o tipo da maré continuam úteis
+					height, _ := tide.TideHeightMt.Float64()
+					day.Tides = append(day.Tides, TideSummary{Time: tide.TideTime, HeightM: height, Type: tide.TideType})
+				}
+			}
+		}
+		if forecastDay.Hour != nil {
+			for _, hour := range *forecastDay.Hour {
+				day.Hours = append(day.Hours, MarineHourSummary{
+					Time:           hour.Time,
+					WaveHeightM:    hour.SigHtMt,
+					SwellHeightM:   hour.SwellHtMt,
+					SwellDirection: hour.SwellDir16Point,
+					SwellPeriodS:   hour.SwellPeriodSecs,
+					WaterTempC:     hour.WaterTempC,
+				})
+			}
+		}
+		response.Days = append(response.Days, day)
+	}
+	return response
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+// marineJSON é uma resposta do marine.json da WeatherAPI, com a altura da maré como string
+const marineJSON = `{"location":{"name":"Rio de Janeiro","lat":-22.9,"lon":-43.23},"forecast":{"forecastday":[{
+	"date":"2024-05-01",
+	"day":{"tides":[{"tide":[{"tide_time":"2024-05-01 03:12","tide_height_mt":"1.20","tide_type":"HIGH"},{"tide_time":"2024-05-01 09:30","tide_height_mt":"0.15","tide_type":"LOW"}]}]},
+	"hour":[{"time":"2024-05-01 00:00","sig_ht_mt":1.4,"swell_ht_mt":1.1,"swell_dir_16_point":"SSE","swell_period_secs":9.5,"water_temp_c":23}]
+}]}}`
+
+func getMarine(t *testing.T, target string, lat float32, lon float32, fetch func(ctx context.Context, query string, lang string, days int, date string, unixdt int, hour int) (external.Marine, error)) *httptest.ResponseRecorder {
+	t.Helper()
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "20541155", City: "Rio de Janeiro", State: "RJ"}})
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		weather := weatherUpdatedAt(time.Now(), 25)
+		weather.Location.Lat, weather.Location.Lon = lat, lon
+		return weather, nil
+	})
+	previous := marineWeather
+	marineWeather = fetch
+	t.Cleanup(func() { marineWeather = previous })
+
+	recorder := httptest.NewRecorder()
+	marineHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func TestMarineHandlerAnswersTidesAndWaves(t *testing.T) {
+	var requestedDays int
+	recorder := getMarine(t, "/marine/20541-155?days=2", -22.9, -43.23, func(ctx context.Context, query string, lang string, days int, date string, unixdt int, hour int) (external.Marine, error) {
+		requestedDays = days
+		var marine external.Marine
+		err := json.Unmarshal([]byte(marineJSON), &marine)
+		return marine, err
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("marineHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if requestedDays != 2 {
+		t.Errorf("marineHandler() asked WeatherAPI for %d days", requestedDays)
+	}
+
+	var response MarineResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("marineHandler() answered an invalid body: %v", err)
+	}
+	if response.City != "Rio de Janeiro" || response.CoastDistanceKm > marineCoastDistanceKm || len(response.Days) != 1 {
+		t.Fatalf("marineHandler() answered %+v", response)
+	}
+	day := response.Days[0]
+	if len(day.Tides) != 2 || day.Tides[0] != (TideSummary{Time: "2024-05-01 03:12", HeightM: 1.2, Type: "HIGH"}) {
+		t.Errorf("marineHandler() answered the tides %+v", day.Tides)
+	}
+	if len(day.Hours) != 1 || day.Hours[0].WaveHeightM != 1.4 || day.Hours[0].SwellDirection != "SSE" {
+		t.Errorf("marineHandler() answered the hours %+v", day.Hours)
+	}
+}
+
+func TestMarineHandlerRejectsInlandCep(t *testing.T) {
+	// Brasília fica a centenas de km do mar
+	recorder := getMarine(t, "/marine/70040010", -15.79, -47.88, func(ctx context.Context, query string, lang string, days int, date string, unixdt int, hour int) (external.Marine, error) {
+		t.Errorf("marineHandler() asked WeatherAPI for the tides of an inland city")
+		return external.Marine{}, nil
+	})
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("marineHandler() answered %d, expected %d", recorder.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestMarineHandlerRejectsDays(t *testing.T) {
+	recorder := getMarine(t, "/marine/20541155?days=8", -22.9, -43.23, func(ctx context.Context, query string, lang string, days int, date string, unixdt int, hour int) (external.Marine, error) {
+		t.Errorf("marineHandler() called WeatherAPI for an invalid range")
+		return external.Marine{}, nil
+	})
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("marineHandler() answered %d, expected %d", recorder.Code, http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,94 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrEmpty is returned when a source has no value configured.
+var ErrEmpty = errors.New("secret is empty")
+
+// Source returns the current value of a secret, it may change over time.
+type Source interface {
+	Value() (string, error)
+}
+
+// Static is a secret known at startup, like one read from an env var or the config file.
+type Static string
+
+func (s Static) Value() (string, error) {
+	if s == "" {
+		return "", ErrEmpty
+	}
+	return string(s), nil
+}
+
+// Env reads the env var on every call.
+type Env string
+
+func (e Env) Value() (string, error) {
+	value := strings.TrimSpace(os.Getenv(string(e)))
+	if value == "" {
+		return "", fmt.Errorf("%s: %w", string(e), ErrEmpty)
+	}
+	return value, nil
+}
+
+// File reads a secret from a file, like a Docker or Kubernetes secret mount.
+// The file is checked again at most once per CheckInterval and re-read when it changes,
+// so a rotated secret is picked up without a restart.
+type File struct {
+	path          string
+	CheckInterval time.Duration
+
+	mu        sync.Mutex
+	value     string
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+}
+
+func NewFile(path string) *File {
+	return &File{path: path, CheckInterval: time.Second}
+}
+
+func (f *File) Value() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if !f.checkedAt.IsZero() && now.Sub(f.checkedAt) < f.CheckInterval {
+		return f.current()
+	}
+	f.checkedAt = now
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		f.value = ""
+		return "", fmt.Errorf("reading secret file: %w", err)
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size && f.value != "" {
+		return f.current()
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		f.value = ""
+		return "", fmt.Errorf("reading secret file: %w", err)
+	}
+	f.value = strings.TrimSpace(string(data))
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return f.current()
+}
+
+func (f *File) current() (string, error) {
+	if f.value == "" {
+		return "", fmt.Errorf("%s: %w", f.path, ErrEmpty)
+	}
+	return f.value, nil
+}
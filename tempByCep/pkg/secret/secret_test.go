@@ -0,0 +1,72 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRereadsRotatedSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather_api_key")
+	os.WriteFile(path, []byte("first-key\n"), 0o600)
+
+	source := NewFile(path)
+	source.CheckInterval = 0
+
+	value, err := source.Value()
+	if err != nil || value != "first-key" {
+		t.Fatalf("Value() = %q, %v", value, err)
+	}
+
+	// a rotação troca o conteúdo e o mtime do arquivo
+	os.WriteFile(path, []byte("second-key-rotated"), 0o600)
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+
+	value, err = source.Value()
+	if err != nil || value != "second-key-rotated" {
+		t.Errorf("Value() = %q, %v, expected the rotated key", value, err)
+	}
+}
+
+func TestFileCachesBetweenChecks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather_api_key")
+	os.WriteFile(path, []byte("first-key"), 0o600)
+
+	source := NewFile(path)
+	source.CheckInterval = time.Hour
+	source.Value()
+
+	os.Remove(path)
+	value, err := source.Value()
+	if err != nil || value != "first-key" {
+		t.Errorf("Value() = %q, %v, expected the cached key", value, err)
+	}
+}
+
+func TestFileMissingOrEmpty(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := NewFile(filepath.Join(dir, "missing")).Value(); err == nil {
+		t.Errorf("Value() did not fail for a missing file")
+	}
+
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, []byte("\n"), 0o600)
+	if _, err := NewFile(empty).Value(); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Value() returned %v, expected %v", err, ErrEmpty)
+	}
+}
+
+func TestStaticAndEnv(t *testing.T) {
+	if _, err := Static("").Value(); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Static(\"\").Value() returned %v, expected %v", err, ErrEmpty)
+	}
+
+	t.Setenv("SECRET_TEST_KEY", " from-env ")
+	value, err := Env("SECRET_TEST_KEY").Value()
+	if err != nil || value != "from-env" {
+		t.Errorf("Env.Value() = %q, %v", value, err)
+	}
+}
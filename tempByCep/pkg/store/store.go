@@ -0,0 +1,209 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+// CepStore persists resolved addresses so they survive restarts
+// and can be served when every CEP provider is down.
+type CepStore interface {
+	Get(cep string) (external.Address, bool, error)
+	Put(cep string, address external.Address) error
+	Delete(cep string) error
+	// All returns every stored address keyed by CEP, used to warm up the caches.
+	All() (map[string]external.Address, error)
+	Close() error
+}
+
+// NormalizeCep é a chave usada pelos stores, só os dígitos.
+func NormalizeCep(cep string) string {
+	return strings.ReplaceAll(strings.TrimSpace(cep), "-", "")
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// record é uma linha do arquivo, o estado final é o replay de todas as linhas.
+type record struct {
+	Op      string            `json:"op"`
+	Cep     string            `json:"cep"`
+	Address *external.Address `json:"address,omitempty"`
+	At      time.Time         `json:"at"`
+}
+
+// FileCepStore is an append only JSON lines log kept fully in memory.
+// Every write is appended and synced, the log is compacted when opened.
+type FileCepStore struct {
+	path string
+
+	mu        sync.RWMutex
+	file      *os.File
+	addresses map[string]external.Address
+}
+
+// OpenFileCepStore replays and compacts the log at path, creating it if needed.
+func OpenFileCepStore(path string) (*FileCepStore, error) {
+	s := &FileCepStore{path: path, addresses: map[string]external.Address{}}
+
+	err := s.replay()
+	if err != nil {
+		return nil, err
+	}
+	err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening cep store: %w", err)
+	}
+	return s, nil
+}
+
+func (s *FileCepStore) replay() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening cep store: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var corrupted error
+	for line := 1; scanner.Scan(); line++ {
+		// só a última linha pode estar cortada (crash no meio da escrita), ela é descartada
+		if corrupted != nil {
+			return corrupted
+		}
+		var r record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			corrupted = fmt.Errorf("cep store %s line %d: %w", s.path, line, err)
+			continue
+		}
+		switch {
+		case r.Op == opPut && r.Address != nil:
+			s.addresses[r.Cep] = *r.Address
+		case r.Op == opDelete:
+			delete(s.addresses, r.Cep)
+		}
+	}
+	return scanner.Err()
+}
+
+// compact reescreve o log só com o estado atual, de forma atômica.
+func (s *FileCepStore) compact() error {
+	err := os.MkdirAll(filepath.Dir(s.path), 0o755)
+	if err != nil {
+		return fmt.Errorf("creating cep store dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("compacting cep store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	now := time.Now()
+	for cep, address := range s.addresses {
+		address := address
+		err = encoder.Encode(record{Op: opPut, Cep: cep, Address: &address, At: now})
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("compacting cep store: %w", err)
+		}
+	}
+	if err = writer.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("compacting cep store: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileCepStore) append(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("writing cep store: %w", err)
+	}
+	return s.file.Sync()
+}
+
+func (s *FileCepStore) Get(cep string) (external.Address, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	address, ok := s.addresses[NormalizeCep(cep)]
+	return address, ok, nil
+}
+
+func (s *FileCepStore) Put(cep string, address external.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cep = NormalizeCep(cep)
+	err := s.append(record{Op: opPut, Cep: cep, Address: &address, At: time.Now()})
+	if err != nil {
+		return err
+	}
+	s.addresses[cep] = address
+	return nil
+}
+
+func (s *FileCepStore) Delete(cep string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cep = NormalizeCep(cep)
+	if _, ok := s.addresses[cep]; !ok {
+		return nil
+	}
+	err := s.append(record{Op: opDelete, Cep: cep, At: time.Now()})
+	if err != nil {
+		return err
+	}
+	delete(s.addresses, cep)
+	return nil
+}
+
+func (s *FileCepStore) All() (map[string]external.Address, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make(map[string]external.Address, len(s.addresses))
+	for cep, address := range s.addresses {
+		all[cep] = address
+	}
+	return all, nil
+}
+
+func (s *FileCepStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
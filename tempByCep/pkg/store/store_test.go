@@ -0,0 +1,72 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+func TestFileCepStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "ceps.jsonl")
+
+	s, err := OpenFileCepStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileCepStore() returned an error: %v", err)
+	}
+	s.Put("20541-155", external.Address{Cep: "20541-155", City: "Rio de Janeiro", Source: "ViaCEP"})
+	s.Put("25900028", external.Address{Cep: "25900028", City: "Magé", Source: "brasilAPI"})
+	s.Put("25900028", external.Address{Cep: "25900028", City: "Mage", Source: "ViaCEP"})
+	s.Delete("20541155")
+	s.Close()
+
+	s, err = OpenFileCepStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileCepStore() returned an error: %v", err)
+	}
+	defer s.Close()
+
+	if _, ok, _ := s.Get("20541155"); ok {
+		t.Errorf("Get() returned a deleted cep")
+	}
+	address, ok, err := s.Get("25900-028")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v", ok, err)
+	}
+	if address.City != "Mage" {
+		t.Errorf("Get() returned %s, expected the last written address", address.City)
+	}
+
+	all, _ := s.All()
+	if len(all) != 1 {
+		t.Errorf("All() returned %d addresses, expected 1", len(all))
+	}
+}
+
+func TestFileCepStoreIgnoresTruncatedLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ceps.jsonl")
+	data := `{"op":"put","cep":"25900028","address":{"cep":"25900028","city":"Mage"}}` + "\n" + `{"op":"put","cep":"2054`
+	os.WriteFile(path, []byte(data), 0o644)
+
+	s, err := OpenFileCepStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileCepStore() returned an error: %v", err)
+	}
+	defer s.Close()
+
+	if _, ok, _ := s.Get("25900028"); !ok {
+		t.Errorf("Get() lost the valid address")
+	}
+}
+
+func TestFileCepStoreRejectsCorruptedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ceps.jsonl")
+	data := `not json` + "\n" + `{"op":"put","cep":"25900028","address":{"cep":"25900028","city":"Mage"}}` + "\n"
+	os.WriteFile(path, []byte(data), 0o644)
+
+	_, err := OpenFileCepStore(path)
+	if err == nil {
+		t.Errorf("OpenFileCepStore() accepted a corrupted log")
+	}
+}
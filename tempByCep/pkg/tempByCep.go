@@ -2,31 +2,75 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/cache"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/config"
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/infra/telemetry"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/store"
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Result struct {
-	Address external.Address
-	Err     error
+	Address  external.Address
+	Err      error
+	Provider string
 }
 
+// RaceMode defines which answer CepConcurrency accepts from the providers.
+type RaceMode string
+
+const (
+	// FirstResponse returns whatever arrives first, even an error.
+	FirstResponse RaceMode = "first-response"
+	// FirstSuccess waits for the first valid Address.
+	FirstSuccess RaceMode = "first-success"
+	// Merge waits every provider within cepMergeBudget and reconciles their answers.
+	Merge RaceMode = "merge"
+)
+
+func parseRaceMode(mode string) (RaceMode, error) {
+	switch RaceMode(mode) {
+	case "":
+		return FirstSuccess, nil
+	case FirstResponse, FirstSuccess, Merge:
+		return RaceMode(mode), nil
+	}
+	return "", fmt.Errorf("unknown cep race mode %q", mode)
+}
+
+var cepRegistry = external.DefaultCepRegistry()
+var cepRaceMode = FirstSuccess
+
+// cepRaceTimeout limita a corrida inteira, o prazo da request tem precedência se for menor
+var cepRaceTimeout = 4 * time.Second
+
+// cepMergeBudget é quanto o modo merge espera pelos providers mais lentos
+var cepMergeBudget = 3 * time.Second
+
+// adminToken protege as rotas /admin/ quando definido
+var adminToken string
+
 type TempResponse struct {
 	// Location *external.Location `json:"location"`
 	City   string  `json:"city"`
@@ -40,16 +84,44 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	shutdown, err := telemetry.SetupProvider(ctx, "tempByCep")
+	// sem config válida o serviço nem sobe
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("config:\n%s", cfg)
+	err = applyConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// sem CEP_STORE_PATH o serviço roda só com o cache de memória
+	if cfg.Cep.StorePath != "" {
+		fileStore, err := store.OpenFileCepStore(cfg.Cep.StorePath)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		defer fileStore.Close()
+		cepStore = fileStore
+
+		err = warmUpCepCache()
+		if err != nil {
+			log.Print(err)
+			return
+		}
+	}
+
+	shutdown, err := telemetry.SetupProvider(ctx, "tempByCep", cfg.CollectorAddr)
 	if err != nil {
 		return
 	}
 
 	srv := &http.Server{
-		Addr:         ":8090",
+		Addr:         ":" + strconv.Itoa(cfg.Port),
 		BaseContext:  func(_ net.Listener) context.Context { return ctx },
 		ReadTimeout:  time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
 		Handler:      mainHttpHanlder(),
 	}
 	defer func() {
@@ -78,6 +150,53 @@ func main() {
 
 }
 
+// applyConfig repassa a config carregada no boot para os pacotes e variáveis do serviço.
+func applyConfig(cfg config.Config) error {
+	external.Configure(external.Settings{
+		CepRequestTimeout:     time.Duration(cfg.Cep.RequestTimeout),
+		BrasilAPICepVersion:   cfg.Cep.BrasilAPIVersion,
+		WeatherBaseURL:        cfg.Weather.BaseURL,
+		WeatherAPIKey:         cfg.Weather.APIKeySource(),
+		WeatherRequestTimeout: time.Duration(cfg.Weather.RequestTimeout),
+		NominatimBaseURL:      cfg.Geocoding.NominatimURL,
+		GeocodingUserAgent:    cfg.Geocoding.UserAgent,
+	})
+
+	// o registry é recriado para pegar o timeout configurado
+	cepRegistry = external.DefaultCepRegistry()
+	err := cepRegistry.ApplySpec(cfg.Cep.Providers)
+	if err != nil {
+		return err
+	}
+	reverseGeocoder, err = external.ReverseGeocoderByName(cfg.Geocoding.Reverse)
+	if err != nil {
+		return err
+	}
+	forwardGeocoder, err = external.ForwardGeocoderByName(cfg.Geocoding.Forward)
+	if err != nil {
+		return err
+	}
+	trustedProxies, err = cfg.TrustedProxyPrefixes()
+	if err != nil {
+		return err
+	}
+	cepRaceMode, err = parseRaceMode(cfg.Cep.RaceMode)
+	if err != nil {
+		return err
+	}
+	cepRaceTimeout = time.Duration(cfg.Cep.RaceTimeout)
+	cepMergeBudget = time.Duration(cfg.Cep.MergeBudget)
+	forwardGeocodeBudget = time.Duration(cfg.Geocoding.ForwardBudget)
+	cepCacheTTL = time.Duration(cfg.Cep.CacheTTL)
+	cepCacheNegativeTTL = time.Duration(cfg.Cep.CacheNegativeTTL)
+	cepCache = cache.New[string, cepCacheEntry]("cep", cfg.Cep.CacheMaxEntries)
+	adminToken = cfg.AdminToken
+	batchMaxSize = cfg.Batch.MaxSize
+	batchConcurrency = cfg.Batch.Concurrency
+	batchTimeout = time.Duration(cfg.Batch.Timeout)
+	return nil
+}
+
 func mainHttpHanlder() http.Handler {
 	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	mux := http.NewServeMux()
@@ -93,7 +212,17 @@ func mainHttpHanlder() http.Handler {
 	mux.Handle("/metrics", promhttp.Handler())
 
 	handleFunc("/cep/", cepHandler)
+	handleFunc("/temp", tempByCoordinatesHandler)
 	handleFunc("/temp/", tempHandler)
+	handleFunc("/temp/batch", tempBatchHandler)
+	handleFunc("/temp/by-ip", tempByIPHandler)
+	handleFunc("/forecast/", forecastHandler)
+	handleFunc("/future/", futureHandler)
+	handleFunc("/astronomy/", astronomyHandler)
+	handleFunc("/marine/", marineHandler)
+	handleFunc("/timezone/", timezoneHandler)
+	handleFunc("/locations", locationsHandler)
+	handleFunc("/admin/cep/", adminCepHandler)
 	// remover para não poluir o zipkin da atividade com as rotas de metrics
 	//handler := otelhttp.NewHandler(mux, "/")
 	return mux
@@ -110,22 +239,15 @@ func cepHandler(w http.ResponseWriter, r *http.Request) {
 
 	path := strings.Split(r.URL.Path, "/")
 	if len(path) < 3 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		writeError(ctx, w, r, apperr.New(apperr.MalformedRequest, "invalid url"))
 		return
 	}
 	cep := path[2]
 	// remove separator if exists
 	cep = strings.ReplaceAll(cep, "-", "")
-	c, err := CepConcurrency(ctx, cep)
+	c, err := CachedCepConcurrency(ctx, cep)
 	if err != nil {
-		if err.Error() == "422 invalid zipcode" {
-			w.WriteHeader(http.StatusUnprocessableEntity) // 422
-		}
-		if err.Error() == "404 can not find zipcode" {
-			w.WriteHeader(http.StatusNotFound) // 404
-		}
-		w.WriteHeader(http.StatusGatewayTimeout) // 504
-		w.Write([]byte(err.Error()))
+		writeError(ctx, w, r, err)
 		return
 	}
 	// Set the Content-Type header to application/json
@@ -133,8 +255,7 @@ func cepHandler(w http.ResponseWriter, r *http.Request) {
 
 	jsonData, err := json.Marshal(c)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(ctx, w, r, err)
 		return
 	}
 	log.Print(string(jsonData))
@@ -150,83 +271,260 @@ func tempHandler(w http.ResponseWriter, r *http.Request) {
 	defer span.End()
 	path := strings.Split(r.URL.Path, "/")
 	if len(path) < 3 {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		writeError(ctx, w, r, apperr.New(apperr.MalformedRequest, "invalid url"))
 		return
 	}
 	cep := path[2]
 	// remove separator if exists
 	cep = strings.ReplaceAll(cep, "-", "")
-	c, err := CepConcurrency(ctx, cep)
+	temp, err := resolveTemp(ctx, cep)
 	if err != nil {
-		if err.Error() == "422 invalid zipcode" {
-			w.WriteHeader(http.StatusUnprocessableEntity) // 422
-		}
-		if err.Error() == "404 can not find zipcode" {
-			w.WriteHeader(http.StatusNotFound) // 404
-		}
-		w.WriteHeader(http.StatusGatewayTimeout) // 504
-		w.Write([]byte(err.Error()))
+		writeError(ctx, w, r, err)
 		return
 	}
 
-	q := strings.Join([]string{utils.RemoveAccents(c.City), utils.RemoveAccents(c.State), "brazil"}, "-")
+	// Set the Content-Type header to application/json
+	w.Header().Set("Content-Type", "application/json")
 
-	temp, err := external.CurrentWeather(ctx, q, "pt")
+	jsonData, err := json.Marshal(temp)
 	if err != nil {
-		fmt.Println(err.Error())
-		w.Write([]byte(err.Error()))
+		writeError(ctx, w, r, err)
 		return
+	}
 
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// resolveTemp busca o endereço do CEP e a temperatura atual da cidade.
+func resolveTemp(ctx context.Context, cep string) (TempResponse, error) {
+	c, err := CachedCepConcurrency(ctx, cep)
+	if err != nil {
+		return TempResponse{}, err
 	}
 
-	// Set the Content-Type header to application/json
-	w.Header().Set("Content-Type", "application/json")
+	temp, err := CachedCurrentWeather(ctx, weatherQuery(ctx, c), "pt")
+	if err != nil {
+		return TempResponse{}, err
+	}
+
+	return newTempResponse(temp), nil
+}
 
-	TempResponse := TempResponse{
+func newTempResponse(temp external.CurrentModel) TempResponse {
+	return TempResponse{
 		//Location: temp.Location,
 		City:   temp.Location.Name,
 		Temp_C: temp.Current.TempC,
 		Temp_F: temp.Current.TempF,
-		Temp_K: temp.Current.TempC + 273,
+		Temp_K: kelvin(temp.Current.TempC),
+	}
+}
+
+// pathCep lê o CEP de rotas como /forecast/{cep}, sem o separador
+func pathCep(r *http.Request, prefix string) (string, error) {
+	cep := strings.ReplaceAll(strings.TrimPrefix(r.URL.Path, prefix), "-", "")
+	if cep == "" || strings.Contains(cep, "/") {
+		return "", apperr.New(apperr.MalformedRequest, "invalid url")
 	}
-	jsonData, err := json.Marshal(TempResponse)
+	return cep, nil
+}
+
+func kelvin(celsius float32) float32 {
+	return celsius + 273
+}
+
+// adminCepHandler remove um CEP do store e do cache: DELETE /admin/cep/{cep}
+func adminCepHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("cep").Start(ctx, "adminCepHandler")
+	defer span.End()
+
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeError(ctx, w, r, apperr.New(apperr.MethodNotAllowed, "only DELETE is allowed"))
+		return
+	}
+	// sem token a rota fica fechada, senão qualquer um que alcance a porta apagaria o store
+	if adminToken == "" {
+		writeError(ctx, w, r, apperr.New(apperr.Misconfigured, "admin routes are disabled, ADMIN_TOKEN is not set"))
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		writeError(ctx, w, r, apperr.New(apperr.Unauthorized, "missing or invalid admin token"))
+		return
+	}
+
+	cep := strings.TrimPrefix(r.URL.Path, "/admin/cep/")
+	if utils.ValidateCep(cep) != nil {
+		writeError(ctx, w, r, utils.InvalidZipError)
+		return
+	}
+
+	err := PurgeCep(cep)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(ctx, w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	log.Print(string(jsonData))
-	w.Write(jsonData)
+// writeError answers with a problem document for err and records it on the span of ctx,
+// an unclassified failure of a request that ran out of time is answered as a timeout.
+func writeError(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	if apperr.KindOf(err) == nil && ctx.Err() != nil {
+		err = apperr.Wrap(apperr.UpstreamTimeout, err, "request did not finish in time")
+	}
+	log.Print(err)
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, apperr.Message(err))
+	apperr.Write(ctx, w, r, err)
 }
 
 func CepConcurrency(ctx context.Context, cep string) (external.Address, error) {
 	ctx, internalSpan := otel.GetTracerProvider().Tracer("cep").Start(ctx, "concurrency-cep")
 	defer internalSpan.End()
-	c1 := make(chan Result)
-	c2 := make(chan Result)
+	internalSpan.SetAttributes(attribute.String("cep.race.mode", string(cepRaceMode)))
 
-	go func() {
-		data, err := external.BrasilApiCep(ctx, cep)
-		c1 <- Result{Address: data, Err: err}
-	}()
-	go func() {
-		data, err := external.ViaCep(ctx, cep)
-		c2 <- Result{Address: data, Err: err}
-	}()
+	// valida antes de disparar as requests, todos os providers dariam o mesmo erro
+	err := utils.ValidateCep(cep)
+	if err != nil {
+		return external.Address{}, utils.InvalidZipError
+	}
 
-	select {
-	case res := <-c1:
-		if res.Err != nil {
-			return external.Address{}, res.Err
+	providers := cepRegistry.Providers()
+	if len(providers) == 0 {
+		return external.Address{}, apperr.New(apperr.Misconfigured, "no cep provider enabled")
+	}
+
+	// o prazo da corrida nunca passa do prazo da request, e ao retornar
+	// cancela os providers que perderam a corrida
+	ctx, cancel := context.WithTimeout(ctx, cepRaceTimeout)
+	defer cancel()
+
+	// buffer para que os perdedores consigam enviar e terminar mesmo depois do retorno
+	results := make(chan Result, len(providers))
+	for _, provider := range providers {
+		go func(provider external.RegisteredCepProvider) {
+			results <- lookupCep(ctx, provider, cep)
+		}(provider)
+	}
+
+	mode := cepRaceMode
+	// no modo merge espera todos os providers até o fim do orçamento
+	var budget <-chan time.Time
+	if mode == Merge {
+		timer := time.NewTimer(cepMergeBudget)
+		defer timer.Stop()
+		budget = timer.C
+	}
+
+	answers := map[string]external.Address{}
+	notFound := 0
+	var errs []error
+	for received := 0; received < len(providers); {
+		select {
+		case res := <-results:
+			received++
+			if res.Err == nil {
+				if mode == Merge {
+					answers[res.Provider] = res.Address
+					continue
+				}
+				internalSpan.SetAttributes(attribute.String("cep.provider", res.Provider))
+				return res.Address, nil
+			}
+			if mode == FirstResponse {
+				internalSpan.SetAttributes(attribute.String("cep.provider", res.Provider))
+				return external.Address{}, res.Err
+			}
+
+			internalSpan.AddEvent("cep provider failed", trace.WithAttributes(
+				attribute.String("cep.provider", res.Provider),
+				attribute.String("error", res.Err.Error()),
+			))
+			if errors.Is(res.Err, utils.ZipNotFoundError) {
+				notFound++
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", res.Provider, res.Err))
+		case <-budget:
+			if len(answers) > 0 {
+				return mergeAnswers(internalSpan, providers, answers), nil
+			}
+			// ninguém respondeu dentro do orçamento, vale o primeiro sucesso
+			internalSpan.AddEvent("cep merge budget exhausted")
+			mode = FirstSuccess
+		case <-ctx.Done():
+			if len(answers) > 0 {
+				return mergeAnswers(internalSpan, providers, answers), nil
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return external.Address{}, apperr.Wrap(apperr.UpstreamTimeout, ctx.Err(), "timeout reached, no API returned in time. CEP: "+cep)
+			}
+			return external.Address{}, ctx.Err()
 		}
-		return res.Address, nil
-	case res := <-c2:
-		if res.Err != nil {
-			return external.Address{}, res.Err
+	}
+
+	if len(answers) > 0 {
+		return mergeAnswers(internalSpan, providers, answers), nil
+	}
+	// só é 404 quando todos os providers concordam
+	if notFound == len(providers) {
+		return external.Address{}, utils.ZipNotFoundError
+	}
+	return external.Address{}, apperr.Wrap(providersFailureKind(errs), errors.Join(errs...), "no cep provider could resolve "+cep)
+}
+
+// providersFailureKind is the kind shared by every provider error, or upstream unavailable when they differ.
+func providersFailureKind(errs []error) *apperr.Kind {
+	kind := apperr.KindOf(errs[0])
+	for _, err := range errs[1:] {
+		if apperr.KindOf(err) != kind {
+			return apperr.UpstreamUnavailable
 		}
-		return res.Address, nil
-	case <-time.After(time.Second * 30):
-		return external.Address{}, errors.New("Timeout Reached, no API returned in time. CEP: " + cep)
 	}
+	if kind == nil || kind == apperr.InvalidInput || kind == apperr.NotFound {
+		return apperr.UpstreamUnavailable
+	}
+	return kind
+}
+
+// mergeAnswers reconciles the successful answers in priority order and
+// records on the span which provider supplied each field.
+func mergeAnswers(span trace.Span, providers []external.RegisteredCepProvider, answers map[string]external.Address) external.Address {
+	ordered := make([]external.Address, 0, len(answers))
+	for _, provider := range providers {
+		if address, ok := answers[provider.Name()]; ok {
+			ordered = append(ordered, address)
+		}
+	}
+
+	merged := external.MergeAddresses(ordered)
+	span.SetAttributes(attribute.String("cep.provider", merged.Source))
+
+	var disagreements []string
+	for _, source := range merged.Sources {
+		span.SetAttributes(attribute.String("cep.merge."+source.Field+".provider", source.Provider))
+		for _, d := range source.Disagreements {
+			disagreements = append(disagreements, fmt.Sprintf("%s: %s=%q %s=%q", source.Field, source.Provider, source.Value, d.Provider, d.Value))
+		}
+	}
+	if len(disagreements) > 0 {
+		span.SetAttributes(attribute.StringSlice("cep.merge.disagreements", disagreements))
+	}
+	return merged
+}
+
+// lookupCep runs a single provider applying its own timeout.
+func lookupCep(ctx context.Context, provider external.RegisteredCepProvider, cep string) Result {
+	if provider.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, provider.Config.Timeout)
+		defer cancel()
+	}
+	data, err := provider.Lookup(ctx, cep)
+	return Result{Address: data, Err: err, Provider: provider.Name()}
 }
@@ -1,19 +1,39 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
 	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/utils"
 )
 
+// requireLiveCepProviders pula os testes que consultam a BrasilAPI e o ViaCEP de verdade, que só rodam
+// com LIVE_TESTS definido. A corrida é coberta offline pelos providers falsos abaixo.
+func requireLiveCepProviders(t *testing.T) {
+	t.Helper()
+	if os.Getenv("LIVE_TESTS") == "" {
+		t.Skip("LIVE_TESTS is not set, skipping the test against the real CEP providers")
+	}
+}
+
 func TestCepConcurrency(t *testing.T) {
+	requireLiveCepProviders(t)
+
 	cep := "20541-155"
-	result, err := CepConcurrency(cep)
+	result, err := CepConcurrency(context.Background(), cep)
 	if err != nil {
-		t.Errorf("CepConcurrency() returned an error: %v", err)
+		t.Fatalf("CepConcurrency() returned an error: %v", err)
 	}
 
 	if strings.ReplaceAll(result.Cep, "-", "") != strings.ReplaceAll(cep, "-", "") {
@@ -34,8 +54,10 @@ func TestCepConcurrency(t *testing.T) {
 }
 
 func TestCepConcurrencyZipNotFound(t *testing.T) {
+	requireLiveCepProviders(t)
+
 	cep := "90541155"
-	_, err := CepConcurrency(cep)
+	_, err := CepConcurrency(context.Background(), cep)
 	if err == nil {
 		t.Fatalf("CepConcurrency() returned a value instead of an err: %v", err)
 	}
@@ -47,7 +69,7 @@ func TestCepConcurrencyZipNotFound(t *testing.T) {
 
 func TestCepConcurrencyInvalidZipFormat(t *testing.T) {
 	cep := "905411551"
-	_, err := CepConcurrency(cep)
+	_, err := CepConcurrency(context.Background(), cep)
 	if err == nil {
 		t.Fatalf("CepConcurrency() returned a value instead of an err: %v", err)
 	}
@@ -57,8 +79,14 @@ func TestCepConcurrencyInvalidZipFormat(t *testing.T) {
 }
 
 func TestGetTempByCep(t *testing.T) {
+	requireLiveCepProviders(t)
+	// a WeatherAPI de verdade precisa da chave
+	if os.Getenv("WEATHER_API_KEY") == "" {
+		t.Skip("WEATHER_API_KEY is not set, skipping the live WeatherAPI test")
+	}
+
 	cep := "25900-028"
-	result, err := CepConcurrency(cep)
+	result, err := CepConcurrency(context.Background(), cep)
 	if err != nil {
 		t.Errorf("CepConcurrency() returned an error: %v", err)
 	}
@@ -82,9 +110,9 @@ func TestGetTempByCep(t *testing.T) {
 	query := strings.Join([]string{utils.RemoveAccents(result.City), utils.RemoveAccents(result.State), "brazil"}, "-")
 	lang := "pt"
 
-	result2, err := external.CurrentWeather(query, lang)
+	result2, err := external.CurrentWeather(context.Background(), query, lang)
 	if err != nil {
-		t.Errorf("Current() returned an error: %v", err)
+		t.Fatalf("Current() returned an error: %v", err)
 	}
 
 	if *result2.Current == (external.Current{}) {
@@ -110,3 +138,361 @@ func TestGetTempByCep(t *testing.T) {
 		}
 	}
 }
+
+type fakeCepProvider struct {
+	name    string
+	address external.Address
+	err     error
+	delay   time.Duration
+}
+
+func (p fakeCepProvider) Name() string {
+	return p.name
+}
+
+func (p fakeCepProvider) Lookup(ctx context.Context, cep string) (external.Address, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return external.Address{}, ctx.Err()
+	}
+	if p.err != nil {
+		return external.Address{}, p.err
+	}
+	address := p.address
+	address.Source = p.name
+	return address, nil
+}
+
+// withCepProviders troca o registry global pelos providers informados durante o teste.
+func withCepProviders(t *testing.T, providers ...external.CepProvider) {
+	t.Helper()
+	registry := external.NewCepRegistry()
+	for i, p := range providers {
+		err := registry.Register(p, external.CepProviderConfig{Enabled: true, Priority: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := cepRegistry
+	cepRegistry = registry
+	t.Cleanup(func() { cepRegistry = previous })
+	// os providers falsos não vão à rede, o geocoder também não
+	withForwardGeocoder(t, nil)
+}
+
+func TestCepConcurrencyFansOutToRegisteredProviders(t *testing.T) {
+	withCepProviders(t,
+		fakeCepProvider{name: "slow", delay: time.Second, address: external.Address{Cep: "20541155"}},
+		fakeCepProvider{name: "fast", delay: time.Millisecond, address: external.Address{Cep: "20541155"}},
+		fakeCepProvider{name: "medium", delay: 500 * time.Millisecond, address: external.Address{Cep: "20541155"}},
+	)
+
+	result, err := CepConcurrency(context.Background(), "20541155")
+	if err != nil {
+		t.Fatalf("CepConcurrency() returned an error: %v", err)
+	}
+	if result.Source != "fast" {
+		t.Errorf("CepConcurrency() returned %s, expected the fastest provider", result.Source)
+	}
+}
+
+func TestCepConcurrencyWithoutProviders(t *testing.T) {
+	withCepProviders(t)
+
+	_, err := CepConcurrency(context.Background(), "20541155")
+	if err == nil {
+		t.Errorf("CepConcurrency() did not return an error without providers")
+	}
+}
+
+// withRaceMode troca o modo da corrida durante o teste.
+func withRaceMode(t *testing.T, mode RaceMode) {
+	t.Helper()
+	previous := cepRaceMode
+	cepRaceMode = mode
+	t.Cleanup(func() { cepRaceMode = previous })
+}
+
+func TestCepConcurrencyFirstSuccessIgnoresFastFailure(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	withCepProviders(t,
+		fakeCepProvider{name: "fast-404", err: utils.ZipNotFoundError},
+		fakeCepProvider{name: "fast-error", err: errors.New("connection refused")},
+		fakeCepProvider{name: "slow", delay: 50 * time.Millisecond, address: external.Address{Cep: "20541155"}},
+	)
+
+	result, err := CepConcurrency(context.Background(), "20541155")
+	if err != nil {
+		t.Fatalf("CepConcurrency() returned an error: %v", err)
+	}
+	if result.Source != "slow" {
+		t.Errorf("CepConcurrency() returned %s, expected the only successful provider", result.Source)
+	}
+}
+
+func TestCepConcurrencyFirstSuccessAllNotFound(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	withCepProviders(t,
+		fakeCepProvider{name: "a", err: utils.ZipNotFoundError},
+		fakeCepProvider{name: "b", delay: 10 * time.Millisecond, err: utils.ZipNotFoundError},
+	)
+
+	_, err := CepConcurrency(context.Background(), "20541155")
+	if err != utils.ZipNotFoundError {
+		t.Errorf("CepConcurrency() returned %v, expected %v", err, utils.ZipNotFoundError)
+	}
+}
+
+func TestCepConcurrencyFirstSuccessJoinsFailures(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	refused := errors.New("connection refused")
+	unavailable := errors.New("503 service unavailable")
+	withCepProviders(t,
+		fakeCepProvider{name: "a", err: utils.ZipNotFoundError},
+		fakeCepProvider{name: "b", err: refused},
+		fakeCepProvider{name: "c", err: unavailable},
+	)
+
+	_, err := CepConcurrency(context.Background(), "20541155")
+	if err == nil {
+		t.Fatalf("CepConcurrency() did not return an error")
+	}
+	if !errors.Is(err, refused) || !errors.Is(err, unavailable) {
+		t.Errorf("CepConcurrency() did not join the provider errors: %v", err)
+	}
+	if errors.Is(err, utils.ZipNotFoundError) {
+		t.Errorf("CepConcurrency() returned not found while a provider failed: %v", err)
+	}
+}
+
+func TestCepConcurrencyFirstResponseReturnsFastFailure(t *testing.T) {
+	withRaceMode(t, FirstResponse)
+	withCepProviders(t,
+		fakeCepProvider{name: "fast-404", err: utils.ZipNotFoundError},
+		fakeCepProvider{name: "slow", delay: 50 * time.Millisecond, address: external.Address{Cep: "20541155"}},
+	)
+
+	_, err := CepConcurrency(context.Background(), "20541155")
+	if err != utils.ZipNotFoundError {
+		t.Errorf("CepConcurrency() returned %v, expected the first response", err)
+	}
+}
+
+type cancelRecorderProvider struct {
+	cancelled chan struct{}
+}
+
+func (p cancelRecorderProvider) Name() string {
+	return "recorder"
+}
+
+func (p cancelRecorderProvider) Lookup(ctx context.Context, cep string) (external.Address, error) {
+	<-ctx.Done()
+	close(p.cancelled)
+	return external.Address{}, ctx.Err()
+}
+
+func TestCepConcurrencyCancelsLosers(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	loser := cancelRecorderProvider{cancelled: make(chan struct{})}
+	withCepProviders(t,
+		fakeCepProvider{name: "winner", address: external.Address{Cep: "20541155"}},
+		loser,
+	)
+
+	_, err := CepConcurrency(context.Background(), "20541155")
+	if err != nil {
+		t.Fatalf("CepConcurrency() returned an error: %v", err)
+	}
+
+	select {
+	case <-loser.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("CepConcurrency() did not cancel the losing provider")
+	}
+}
+
+// blockingCepProvider só responde quando o contexto é cancelado.
+type blockingCepProvider struct {
+	name string
+}
+
+func (p blockingCepProvider) Name() string {
+	return p.name
+}
+
+func (p blockingCepProvider) Lookup(ctx context.Context, cep string) (external.Address, error) {
+	<-ctx.Done()
+	return external.Address{}, ctx.Err()
+}
+
+func TestCepConcurrencyDoesNotLeakGoroutines(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	withCepProviders(t,
+		fakeCepProvider{name: "winner", address: external.Address{Cep: "20541155"}},
+		blockingCepProvider{name: "loser-1"},
+		blockingCepProvider{name: "loser-2"},
+	)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		_, err := CepConcurrency(context.Background(), "20541155")
+		if err != nil {
+			t.Fatalf("CepConcurrency() returned an error: %v", err)
+		}
+	}
+
+	// os perdedores precisam de um instante para perceber o cancelamento
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("CepConcurrency() leaked %d goroutines", after-before)
+	}
+}
+
+func TestCepConcurrencyHonorsRequestDeadline(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	withCepProviders(t, blockingCepProvider{name: "a"}, blockingCepProvider{name: "b"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := CepConcurrency(ctx, "20541155")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CepConcurrency() returned %v, expected a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CepConcurrency() took %v, ignoring the request deadline", elapsed)
+	}
+}
+
+func TestCepConcurrencyRaceTimeout(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	withCepProviders(t, blockingCepProvider{name: "a"})
+	previous := cepRaceTimeout
+	cepRaceTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { cepRaceTimeout = previous })
+
+	_, err := CepConcurrency(context.Background(), "20541155")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CepConcurrency() returned %v, expected a deadline error", err)
+	}
+	if !errors.Is(err, apperr.UpstreamTimeout) {
+		t.Errorf("CepConcurrency() returned %v, expected an upstream timeout", err)
+	}
+}
+
+func TestCepConcurrencyRequestCancelled(t *testing.T) {
+	withRaceMode(t, FirstSuccess)
+	withCepProviders(t, blockingCepProvider{name: "a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := CepConcurrency(ctx, "20541155")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CepConcurrency() returned %v, expected a canceled error", err)
+	}
+}
+
+func TestCepConcurrencyMergeWaitsForAllProviders(t *testing.T) {
+	withRaceMode(t, Merge)
+	withCepProviders(t,
+		fakeCepProvider{name: "brasilAPI", delay: 30 * time.Millisecond, address: external.Address{Cep: "20541155", City: "Rio de Janeiro", Street: "Rua Barão de Mesquita"}},
+		fakeCepProvider{name: "ViaCEP", address: external.Address{Cep: "20541155", City: "Rio de Janeiro", Neighborhood: "Andaraí", Street: "R. Barao de Mesquita"}},
+		fakeCepProvider{name: "down", err: errors.New("connection refused")},
+	)
+
+	result, err := CepConcurrency(context.Background(), "20541155")
+	if err != nil {
+		t.Fatalf("CepConcurrency() returned an error: %v", err)
+	}
+	// a prioridade vale mais que a ordem de chegada
+	if result.Street != "Rua Barão de Mesquita" || result.Neighborhood != "Andaraí" {
+		t.Errorf("CepConcurrency() did not merge the providers: %+v", result)
+	}
+	if len(result.Sources) == 0 {
+		t.Errorf("CepConcurrency() did not return the merge sources")
+	}
+}
+
+func TestCepConcurrencyMergeBudget(t *testing.T) {
+	withRaceMode(t, Merge)
+	previous := cepMergeBudget
+	cepMergeBudget = 20 * time.Millisecond
+	t.Cleanup(func() { cepMergeBudget = previous })
+	withCepProviders(t,
+		fakeCepProvider{name: "fast", address: external.Address{Cep: "20541155", City: "Rio de Janeiro"}},
+		blockingCepProvider{name: "stuck"},
+	)
+
+	start := time.Now()
+	result, err := CepConcurrency(context.Background(), "20541155")
+	if err != nil {
+		t.Fatalf("CepConcurrency() returned an error: %v", err)
+	}
+	if result.Source != "fast" {
+		t.Errorf("CepConcurrency() returned source %s", result.Source)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CepConcurrency() took %v, ignoring the merge budget", elapsed)
+	}
+}
+
+func TestCepHandlerErrorStatus(t *testing.T) {
+	withEmptyCepCache(t)
+	withRaceMode(t, FirstSuccess)
+	tests := []struct {
+		name      string
+		cep       string
+		providers []external.CepProvider
+		status    int
+	}{
+		{"invalid", "123", []external.CepProvider{fakeCepProvider{name: "a"}}, http.StatusUnprocessableEntity},
+		{"not found", "20541155", []external.CepProvider{fakeCepProvider{name: "a", err: utils.ZipNotFoundError}}, http.StatusNotFound},
+		{"rate limited", "20541156", []external.CepProvider{fakeCepProvider{name: "a", err: apperr.New(apperr.RateLimited, "slow down")}}, http.StatusTooManyRequests},
+		{"unavailable", "20541157", []external.CepProvider{fakeCepProvider{name: "a", err: errors.New("connection refused")}}, http.StatusBadGateway},
+		{"no providers", "20541158", nil, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCepProviders(t, tt.providers...)
+			recorder := httptest.NewRecorder()
+			cepHandler(recorder, httptest.NewRequest(http.MethodGet, "/cep/"+tt.cep, nil))
+
+			if recorder.Code != tt.status {
+				t.Errorf("cepHandler() answered %d, expected %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != apperr.ProblemContentType {
+				t.Errorf("cepHandler() answered Content-Type %q", contentType)
+			}
+		})
+	}
+}
+
+func TestTempHandlerAnswersProblem(t *testing.T) {
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "20541155", City: "Rio de Janeiro", State: "RJ"}})
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		return external.CurrentModel{}, apperr.New(apperr.RateLimited, "weatherapi quota exceeded")
+	})
+
+	recorder := httptest.NewRecorder()
+	tempHandler(recorder, httptest.NewRequest(http.MethodGet, "/temp/20541-155", nil))
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("tempHandler() answered %d, expected %d", recorder.Code, http.StatusTooManyRequests)
+	}
+	var problem apperr.Problem
+	err := json.Unmarshal(recorder.Body.Bytes(), &problem)
+	if err != nil {
+		t.Fatalf("tempHandler() answered an invalid problem: %v", err)
+	}
+	if problem.Type != apperr.RateLimited.Type() || problem.Detail != "weatherapi quota exceeded" || problem.Instance != "/temp/20541-155" {
+		t.Errorf("tempHandler() answered %+v", problem)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	// a imagem final é FROM scratch, sem /usr/share/zoneinfo
+	_ "time/tzdata"
+
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// locationTimeZone e timeNow são trocados nos testes
+var locationTimeZone = external.LocationTimeZone
+var timeNow = time.Now
+
+// TimeZoneResponse is the time zone of the city computed with Go's tz database. WeatherAPI's localtime
+// is kept for comparison, OffsetMismatch tells when its offset disagrees with the database.
+type TimeZoneResponse struct {
+	City                string    `json:"city"`
+	TzID                string    `json:"tz_id"`
+	UTCOffset           string    `json:"utc_offset"`
+	UTCOffsetSeconds    int       `json:"utc_offset_seconds"`
+	Abbreviation        string    `json:"abbreviation"`
+	DST                 bool      `json:"dst"`
+	LocalTime           time.Time `json:"local_time"`
+	WeatherAPILocaltime string    `json:"weatherapi_localtime"`
+	OffsetMismatch      bool      `json:"offset_mismatch"`
+}
+
+// timezoneHandler devolve o fuso e a hora local da cidade do CEP: GET /timezone/{cep}
+func timezoneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer("forecast").Start(ctx, "timezoneHandler")
+	defer span.End()
+
+	cep, err := pathCep(r, "/timezone/")
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.String("cep", cep))
+
+	zone, err := resolveTimeZone(ctx, cep)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, err := json.Marshal(zone)
+	if err != nil {
+		writeError(ctx, w, r, err)
+		return
+	}
+	log.Print(string(jsonData))
+	w.Write(jsonData)
+}
+
+// resolveTimeZone busca o endereço do CEP e o fuso da cidade.
+func resolveTimeZone(ctx context.Context, cep string) (TimeZoneResponse, error) {
+	c, err := CachedCepConcurrency(ctx, cep)
+	if err != nil {
+		return TimeZoneResponse{}, err
+	}
+
+	zone, err := locationTimeZone(ctx, weatherQuery(ctx, c))
+	if err != nil {
+		return TimeZoneResponse{}, err
+	}
+	return newTimeZoneResponse(ctx, zone.Location, timeNow())
+}
+
+func newTimeZoneResponse(ctx context.Context, location *external.Location, now time.Time) (TimeZoneResponse, error) {
+	// o fuso vem do tz database do Go, a WeatherAPI só informa qual é
+	zone, err := time.LoadLocation(location.TzID)
+	if err != nil {
+		return TimeZoneResponse{}, apperr.Wrap(apperr.UpstreamUnavailable, err, "weatherapi answered an unknown time zone "+location.TzID)
+	}
+	local := now.In(zone).Truncate(time.Second)
+	abbreviation, offset := local.Zone()
+	response := TimeZoneResponse{
+		City:                location.Name,
+		TzID:                location.TzID,
+		UTCOffset:           local.Format("-07:00"),
+		UTCOffsetSeconds:    offset,
+		Abbreviation:        abbreviation,
+		DST:                 local.IsDST(),
+		LocalTime:           local,
+		WeatherAPILocaltime: location.Localtime,
+	}
+
+	// confere o offset da WeatherAPI no mesmo instante em que ela calculou o localtime
+	span := trace.SpanFromContext(ctx)
+	reported, err := external.LocaltimeOffset(location)
+	if err != nil {
+		span.RecordError(err)
+		return response, nil
+	}
+	_, expected := time.Unix(int64(location.LocaltimeEpoch), 0).In(zone).Zone()
+	if reported != time.Duration(expected)*time.Second {
+		response.OffsetMismatch = true
+		log.Printf("weatherapi offset %v for %s disagrees with the tz database (%ds)", reported, location.TzID, expected)
+		span.SetAttributes(attribute.String("timezone.weatherapi_offset", fmt.Sprint(reported)))
+	}
+	span.SetAttributes(attribute.String("timezone.id", location.TzID), attribute.Bool("timezone.offset_mismatch", response.OffsetMismatch))
+	return response, nil
+}
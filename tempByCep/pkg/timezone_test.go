@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+)
+
+func getTimeZone(t *testing.T, location external.Location, now time.Time) TimeZoneResponse {
+	t.Helper()
+	withEmptyCepCache(t)
+	withCepProviders(t, fakeCepProvider{name: "a", address: external.Address{Cep: "20541155", City: "Rio de Janeiro", State: "RJ"}})
+	previousLookup, previousNow := locationTimeZone, timeNow
+	locationTimeZone = func(ctx context.Context, query string) (external.TimeZone, error) {
+		return external.TimeZone{Location: &location}, nil
+	}
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { locationTimeZone, timeNow = previousLookup, previousNow })
+
+	recorder := httptest.NewRecorder()
+	timezoneHandler(recorder, httptest.NewRequest(http.MethodGet, "/timezone/20541-155", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("timezoneHandler() answered %d: %s", recorder.Code, recorder.Body)
+	}
+	var response TimeZoneResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("timezoneHandler() answered an invalid body: %v", err)
+	}
+	return response
+}
+
+func TestTimezoneHandlerUsesTzDatabase(t *testing.T) {
+	// 2024-05-01 12:00 UTC
+	location := external.Location{Name: "Rio de Janeiro", TzID: "America/Sao_Paulo", Localtime: "2024-05-01 9:00", LocaltimeEpoch: 1714564800}
+	response := getTimeZone(t, location, time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC))
+
+	if response.TzID != "America/Sao_Paulo" || response.UTCOffset != "-03:00" || response.UTCOffsetSeconds != -3*60*60 || response.DST {
+		t.Errorf("timezoneHandler() answered %+v", response)
+	}
+	if response.LocalTime.Format(time.RFC3339) != "2024-05-01T09:00:30-03:00" {
+		t.Errorf("timezoneHandler() answered the local time %s", response.LocalTime.Format(time.RFC3339))
+	}
+	if response.OffsetMismatch {
+		t.Errorf("timezoneHandler() reported a mismatch for a matching localtime")
+	}
+}
+
+func TestTimezoneHandlerKnowsPastDST(t *testing.T) {
+	// São Paulo teve horário de verão até 2019
+	location := external.Location{Name: "Rio de Janeiro", TzID: "America/Sao_Paulo"}
+	response := getTimeZone(t, location, time.Date(2018, 12, 1, 12, 0, 0, 0, time.UTC))
+
+	if !response.DST || response.UTCOffset != "-02:00" {
+		t.Errorf("timezoneHandler() answered %+v, expected the DST offset", response)
+	}
+}
+
+func TestTimezoneHandlerReportsOffsetMismatch(t *testing.T) {
+	// Noronha é -02:00, mas o localtime diz -03:00
+	location := external.Location{Name: "Fernando de Noronha", TzID: "America/Noronha", Localtime: "2024-05-01 9:00", LocaltimeEpoch: 1714564800}
+	response := getTimeZone(t, location, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	if !response.OffsetMismatch || response.UTCOffset != "-02:00" {
+		t.Errorf("timezoneHandler() answered %+v, expected a mismatch and the tz database offset", response)
+	}
+}
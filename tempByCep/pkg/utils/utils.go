@@ -7,6 +7,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/JonecoBoy/otel-cep/shared/apperr"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 )
@@ -14,6 +15,7 @@ import (
 type HttpError struct {
 	Code    int
 	Message string
+	Kind    *apperr.Kind
 }
 
 // Error implements error.
@@ -25,14 +27,21 @@ func (e HttpError) Error() string {
 	return e.Message
 }
 
+// Unwrap lets errors.Is(err, apperr.NotFound) match the predefined errors below.
+func (e HttpError) Unwrap() error {
+	return e.Kind
+}
+
 var InvalidZipError = HttpError{
 	Code:    http.StatusUnprocessableEntity,
 	Message: "422 invalid zipcode",
+	Kind:    apperr.InvalidInput,
 }
 
 var ZipNotFoundError = HttpError{
 	Code:    http.StatusNotFound,
 	Message: "404 can not find zipcode",
+	Kind:    apperr.NotFound,
 }
 
 func ValidateCep(cep string) error {
@@ -58,3 +67,43 @@ func RemoveAccents(s string) string {
 	result, _, _ := transform.String(t, s)
 	return result
 }
+
+// abreviações comuns nos logradouros retornados pelas APIs de CEP
+var addressAbbreviations = map[string]string{
+	"r":    "rua",
+	"av":   "avenida",
+	"avda": "avenida",
+	"al":   "alameda",
+	"tv":   "travessa",
+	"trav": "travessa",
+	"est":  "estrada",
+	"estr": "estrada",
+	"rod":  "rodovia",
+	"pc":   "praca",
+	"pca":  "praca",
+	"pq":   "parque",
+	"lgo":  "largo",
+	"jd":   "jardim",
+	"vl":   "vila",
+	"cel":  "coronel",
+	"dr":   "doutor",
+	"gal":  "general",
+	"pres": "presidente",
+	"sta":  "santa",
+	"sto":  "santo",
+	"sra":  "senhora",
+}
+
+// NormalizeAddress makes two spellings of the same address comparable:
+// no accents, lower case, single spaces and abbreviations like "R." expanded to "rua".
+func NormalizeAddress(s string) string {
+	s = strings.ToLower(RemoveAccents(s))
+	s = strings.NewReplacer(".", " ", ",", " ", "-", " ").Replace(s)
+	words := strings.Fields(s)
+	for i, word := range words {
+		if expanded, ok := addressAbbreviations[word]; ok {
+			words[i] = expanded
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/cache"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// weatherCacheEntry guarda a resposta da WeatherAPI e até quando ela é considerada atual.
+type weatherCacheEntry struct {
+	Weather    external.CurrentModel
+	FreshUntil time.Time
+	// RetryAfter adia a próxima atualização em background depois de uma que falhou
+	RetryAfter time.Time
+}
+
+var weatherCache = cache.New[string, weatherCacheEntry]("weather", 1000)
+
+// a WeatherAPI só atualiza o current a cada 15 minutos (Current.LastUpdatedEpoch)
+var weatherUpdateInterval = 15 * time.Minute
+
+// evita consultar de novo em loop quando a WeatherAPI está atrasada
+var weatherMinFreshness = time.Minute
+
+// por quanto tempo um valor velho ainda pode ser servido enquanto é atualizado
+var weatherStaleTTL = 2 * time.Hour
+
+// quanto esperar para atualizar de novo quando a WeatherAPI falhou, enquanto isso o valor velho é servido
+var weatherRefreshBackoff = time.Minute
+
+// currentWeather é trocado nos testes
+var currentWeather = external.CurrentWeather
+
+func weatherCacheKey(query string, lang string) string {
+	return lang + ":" + strings.ToLower(strings.TrimSpace(query))
+}
+
+// loadWeather consulta a WeatherAPI e calcula a validade a partir do LastUpdatedEpoch.
+func loadWeather(query string, lang string) func(ctx context.Context) (weatherCacheEntry, time.Duration, error) {
+	return func(ctx context.Context) (weatherCacheEntry, time.Duration, error) {
+		weather, err := currentWeather(ctx, query, lang)
+		if err != nil {
+			return weatherCacheEntry{}, 0, err
+		}
+
+		now := time.Now()
+		freshUntil := now.Add(weatherMinFreshness)
+		if weather.Current != nil && weather.Current.LastUpdatedEpoch > 0 {
+			next := time.Unix(int64(weather.Current.LastUpdatedEpoch), 0).Add(weatherUpdateInterval)
+			if next.After(freshUntil) {
+				freshUntil = next
+			}
+		}
+
+		entry := weatherCacheEntry{Weather: weather, FreshUntil: freshUntil}
+		return entry, freshUntil.Sub(now) + weatherStaleTTL, nil
+	}
+}
+
+// CachedCurrentWeather serves CurrentWeather from the cache while it is fresh.
+// Once a city is warm a stale value is returned right away and refreshed in background,
+// so only the first request of a city waits on WeatherAPI.
+func CachedCurrentWeather(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("weather").Start(ctx, "cached-weather")
+	defer span.End()
+
+	key := weatherCacheKey(query, lang)
+	entry, ok := weatherCache.Get(key)
+	if ok {
+		now := time.Now()
+		stale := !now.Before(entry.FreshUntil)
+		backoff := stale && now.Before(entry.RetryAfter)
+		span.SetAttributes(
+			attribute.Bool("weather.cache.hit", true),
+			attribute.Bool("weather.cache.stale", stale),
+			attribute.Bool("weather.cache.refresh_backoff", backoff),
+		)
+		if stale && !backoff {
+			refreshWeather(span, key, query, lang, entry.FreshUntil)
+		}
+		return entry.Weather, nil
+	}
+
+	// o Get já contou o miss, o Load contaria de novo
+	entry, result, err := weatherCache.Reload(ctx, key, loadWeather(query, lang))
+	span.SetAttributes(
+		attribute.Bool("weather.cache.hit", false),
+		attribute.Bool("weather.cache.shared", result.Shared),
+	)
+	if err != nil {
+		return external.CurrentModel{}, err
+	}
+	return entry.Weather, nil
+}
+
+// refreshWeather atualiza a entrada em background, o trace novo fica ligado ao da request.
+// Se falhar, a entrada velha (a de freshUntil) só é atualizada de novo depois do weatherRefreshBackoff.
+func refreshWeather(parent trace.Span, key string, query string, lang string, freshUntil time.Time) {
+	go func() {
+		ctx, span := otel.GetTracerProvider().Tracer("weather").Start(context.Background(), "refresh-weather",
+			trace.WithLinks(trace.Link{SpanContext: parent.SpanContext()}))
+		defer span.End()
+
+		_, _, err := weatherCache.Reload(ctx, key, loadWeather(query, lang))
+		if err != nil {
+			span.RecordError(err)
+			retryAfter := time.Now().Add(weatherRefreshBackoff)
+			weatherCache.Update(key, func(entry weatherCacheEntry) weatherCacheEntry {
+				// outra atualização pode ter dado certo nesse meio tempo
+				if entry.FreshUntil.Equal(freshUntil) {
+					entry.RetryAfter = retryAfter
+				}
+				return entry
+			})
+		}
+	}()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/cache"
+	"github.com/JonecoBoy/otel-cep/tempByCep/pkg/external"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// withFakeWeather troca a WeatherAPI por uma função que conta as chamadas.
+func withFakeWeather(t *testing.T, fetch func(ctx context.Context, query string, lang string) (external.CurrentModel, error)) {
+	t.Helper()
+	previousFetch := currentWeather
+	previousCache := weatherCache
+	currentWeather = fetch
+	weatherCache = cache.New[string, weatherCacheEntry]("weather-test", 100)
+	t.Cleanup(func() {
+		currentWeather = previousFetch
+		weatherCache = previousCache
+	})
+}
+
+func weatherUpdatedAt(updatedAt time.Time, tempC float32) external.CurrentModel {
+	return external.CurrentModel{
+		Location: &external.Location{Name: "Mage"},
+		Current:  &external.Current{LastUpdatedEpoch: int32(updatedAt.Unix()), TempC: tempC},
+	}
+}
+
+// cacheLookups lê o tempbycep_cache_lookups_total do cache e resultado pedidos.
+func cacheLookups(t *testing.T, name string, result string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "tempbycep_cache_lookups_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["cache"] == name && labels["result"] == result {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestCachedCurrentWeatherHonorsLastUpdated(t *testing.T) {
+	var calls atomic.Int32
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		calls.Add(1)
+		return weatherUpdatedAt(time.Now(), 25), nil
+	})
+	misses, hits := cacheLookups(t, "weather-test", "miss"), cacheLookups(t, "weather-test", "hit")
+
+	for i := 0; i < 3; i++ {
+		weather, err := CachedCurrentWeather(context.Background(), "Mage-RJ-brazil", "pt")
+		if err != nil {
+			t.Fatalf("CachedCurrentWeather() returned an error: %v", err)
+		}
+		if weather.Current.TempC != 25 {
+			t.Errorf("CachedCurrentWeather() returned %v", weather.Current.TempC)
+		}
+	}
+	// a chave ignora maiúsculas
+	if _, err := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt"); err != nil {
+		t.Fatalf("CachedCurrentWeather() returned an error: %v", err)
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("WeatherAPI was called %d times, expected 1", calls.Load())
+	}
+	// cada consulta conta uma vez só no hit ratio
+	if got := cacheLookups(t, "weather-test", "miss") - misses; got != 1 {
+		t.Errorf("CachedCurrentWeather() counted %v misses, expected 1", got)
+	}
+	if got := cacheLookups(t, "weather-test", "hit") - hits; got != 3 {
+		t.Errorf("CachedCurrentWeather() counted %v hits, expected 3", got)
+	}
+}
+
+func TestCachedCurrentWeatherStaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int32
+	refreshed := make(chan struct{})
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		if calls.Add(1) == 1 {
+			// atualizado há 20 minutos, já deveria ter um valor novo
+			return weatherUpdatedAt(time.Now().Add(-20*time.Minute), 20), nil
+		}
+		defer close(refreshed)
+		return weatherUpdatedAt(time.Now(), 30), nil
+	})
+	previous := weatherMinFreshness
+	weatherMinFreshness = 0
+	t.Cleanup(func() { weatherMinFreshness = previous })
+
+	first, err := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt")
+	if err != nil || first.Current.TempC != 20 {
+		t.Fatalf("CachedCurrentWeather() = %v, %v", first.Current, err)
+	}
+
+	// o valor velho volta na hora e a atualização acontece em background
+	stale, err := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt")
+	if err != nil || stale.Current.TempC != 20 {
+		t.Fatalf("CachedCurrentWeather() did not serve the stale value: %v, %v", stale.Current, err)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatalf("CachedCurrentWeather() did not refresh the stale value")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		fresh, _ := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt")
+		if fresh.Current.TempC == 30 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("CachedCurrentWeather() never served the refreshed value")
+}
+
+func TestCachedCurrentWeatherDoesNotCacheErrors(t *testing.T) {
+	var calls atomic.Int32
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		calls.Add(1)
+		return external.CurrentModel{}, errors.New("weatherapi down")
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt"); err == nil {
+			t.Fatalf("CachedCurrentWeather() did not return an error")
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("WeatherAPI was called %d times, expected 2", calls.Load())
+	}
+}
+
+func TestCachedCurrentWeatherBacksOffFailedRefresh(t *testing.T) {
+	var calls atomic.Int32
+	refreshed := make(chan struct{}, 10)
+	withFakeWeather(t, func(ctx context.Context, query string, lang string) (external.CurrentModel, error) {
+		if calls.Add(1) == 1 {
+			return weatherUpdatedAt(time.Now().Add(-20*time.Minute), 20), nil
+		}
+		defer func() { refreshed <- struct{}{} }()
+		return external.CurrentModel{}, errors.New("weatherapi down")
+	})
+	previousFreshness, previousBackoff := weatherMinFreshness, weatherRefreshBackoff
+	weatherMinFreshness, weatherRefreshBackoff = 0, time.Hour
+	t.Cleanup(func() { weatherMinFreshness, weatherRefreshBackoff = previousFreshness, previousBackoff })
+
+	if _, err := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt"); err != nil {
+		t.Fatalf("CachedCurrentWeather() returned an error: %v", err)
+	}
+	// a primeira consulta velha dispara a atualização, que falha
+	if _, err := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt"); err != nil {
+		t.Fatalf("CachedCurrentWeather() returned an error: %v", err)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatalf("CachedCurrentWeather() did not refresh the stale value")
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		entry, _ := weatherCache.Get(weatherCacheKey("mage-rj-brazil", "pt"))
+		if !entry.RetryAfter.IsZero() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// durante o backoff o valor velho é servido sem ir à WeatherAPI
+	for i := 0; i < 5; i++ {
+		weather, err := CachedCurrentWeather(context.Background(), "mage-rj-brazil", "pt")
+		if err != nil || weather.Current.TempC != 20 {
+			t.Fatalf("CachedCurrentWeather() = %v, %v", weather.Current, err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if calls.Load() != 2 {
+		t.Errorf("WeatherAPI was called %d times, expected 2", calls.Load())
+	}
+}